@@ -0,0 +1,247 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+var (
+	ErrLockHeld    = errors.New("pq: advisory lock is already held")
+	ErrLockNotHeld = errors.New("pq: advisory lock is not held")
+)
+
+// AdvisoryLockKey identifies an advisory lock. PostgreSQL keeps keys
+// made from one int64 and from two int32s apart, so Key(1) and
+// Key2(0, 1) are different locks.
+type AdvisoryLockKey struct {
+	k1, k2 int64
+	pair   bool
+}
+
+// Key returns the advisory lock key for a single int64.
+func Key(k int64) AdvisoryLockKey {
+	return AdvisoryLockKey{k1: k}
+}
+
+// Key2 returns the advisory lock key for a pair of int32s.
+func Key2(k1, k2 int32) AdvisoryLockKey {
+	return AdvisoryLockKey{k1: int64(k1), k2: int64(k2), pair: true}
+}
+
+func (k AdvisoryLockKey) args() (string, []driver.Value) {
+	if k.pair {
+		return "($1, $2)", []driver.Value{k.k1, k.k2}
+	}
+	return "($1)", []driver.Value{k.k1}
+}
+
+// lockTag returns the classid, objid and objsubid with which the key
+// appears in pg_locks.
+func (k AdvisoryLockKey) lockTag() []driver.Value {
+	if k.pair {
+		return []driver.Value{int64(uint32(k.k1)), int64(uint32(k.k2)), int64(2)}
+	}
+	return []driver.Value{int64(uint64(k.k1) >> 32), int64(uint32(k.k1)), int64(1)}
+}
+
+// AdvisoryLock is a session-level advisory lock. Session locks belong
+// to the connection that took them, which makes them treacherous to
+// use through the pool of an *sql.DB; an AdvisoryLock instead pins a
+// connection of its own from Lock or TryLock until Unlock, and returns
+// it to the pool on Unlock. If that connection is lost the server
+// releases the lock.
+//
+// An AdvisoryLock must not be used concurrently.
+type AdvisoryLock struct {
+	db     *sql.DB
+	key    AdvisoryLockKey
+	conn   *sql.Conn
+	shared bool
+}
+
+// NewAdvisoryLock returns an advisory lock for key, taken with
+// connections from db. No connection is used until the lock is taken.
+func NewAdvisoryLock(db *sql.DB, key AdvisoryLockKey) *AdvisoryLock {
+	return &AdvisoryLock{db: db, key: key}
+}
+
+// Lock takes the lock exclusively, waiting until it is available. If
+// ctx is done while waiting, the wait is cancelled on the server and
+// ctx's error is returned.
+func (l *AdvisoryLock) Lock(ctx context.Context) error {
+	_, err := l.lock(ctx, "pg_advisory_lock", false)
+	return err
+}
+
+// LockShared takes the lock in shared mode, waiting until no exclusive
+// holder remains. Cancellation is as for Lock.
+func (l *AdvisoryLock) LockShared(ctx context.Context) error {
+	_, err := l.lock(ctx, "pg_advisory_lock_shared", true)
+	return err
+}
+
+// TryLock takes the lock exclusively if that is possible without
+// waiting, and reports whether it did.
+func (l *AdvisoryLock) TryLock(ctx context.Context) (bool, error) {
+	return l.lock(ctx, "pg_try_advisory_lock", false)
+}
+
+// TryLockShared takes the lock in shared mode if that is possible
+// without waiting, and reports whether it did.
+func (l *AdvisoryLock) TryLockShared(ctx context.Context) (bool, error) {
+	return l.lock(ctx, "pg_try_advisory_lock_shared", true)
+}
+
+func (l *AdvisoryLock) lock(ctx context.Context, fn string, shared bool) (bool, error) {
+	if l.conn != nil {
+		return false, ErrLockHeld
+	}
+
+	c, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	params, args := l.key.args()
+	v, err := queryValue(ctx, c, "SELECT "+fn+params, args)
+	if err != nil {
+		c.Close()
+		return false, err
+	}
+
+	// The blocking functions return void, which is decoded as empty.
+	if ok, isBool := v.(bool); isBool && !ok {
+		c.Close()
+		return false, nil
+	}
+
+	l.conn = c
+	l.shared = shared
+	return true, nil
+}
+
+// Unlock releases the lock and returns its connection to the pool.
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return ErrLockNotHeld
+	}
+
+	fn := "pg_advisory_unlock"
+	if l.shared {
+		fn = "pg_advisory_unlock_shared"
+	}
+
+	params, args := l.key.args()
+	v, err := queryValue(ctx, l.conn, "SELECT "+fn+params, args)
+	if err != nil {
+		// Make sure the lock is not left behind on a pooled
+		// connection.
+		l.discard()
+		return err
+	}
+
+	l.conn.Close()
+	l.conn = nil
+
+	if ok, _ := v.(bool); !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// discard closes the lock's connection rather than returning it to the
+// pool, so the server releases the lock along with the session.
+func (l *AdvisoryLock) discard() {
+	if l.conn == nil {
+		return
+	}
+
+	discardConn(l.conn)
+	l.conn = nil
+}
+
+// discardConn closes c and its driver connection.
+func discardConn(c *sql.Conn) {
+	c.Raw(func(interface{}) error { return driver.ErrBadConn })
+	c.Close()
+}
+
+// Held reports whether the lock is still held, by asking the server
+// on the lock's connection. Any error, such as driver.ErrBadConn, means
+// that it could not be confirmed.
+func (l *AdvisoryLock) Held(ctx context.Context) (bool, error) {
+	if l.conn == nil {
+		return false, nil
+	}
+	return l.heldOn(ctx, l.conn)
+}
+
+// heldOn reports whether the session of c holds the lock.
+func (l *AdvisoryLock) heldOn(ctx context.Context, c *sql.Conn) (bool, error) {
+	v, err := queryValue(ctx, c, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted
+			AND classid = $1 AND objid = $2 AND objsubid = $3)`,
+		l.key.lockTag())
+	if err != nil {
+		return false, err
+	}
+
+	held, _ := v.(bool)
+	return held, nil
+}
+
+// Conn returns the connection holding the lock, or nil if it is not
+// held.
+func (l *AdvisoryLock) Conn() *sql.Conn {
+	return l.conn
+}
+
+// queryValue runs q on c and returns the first value it produces. If
+// ctx is done before the server replies, the query is cancelled with a
+// cancel request and ctx's error is returned.
+func queryValue(ctx context.Context, c *sql.Conn, q string, args []driver.Value) (v driver.Value, err error) {
+	err = c.Raw(func(dc interface{}) error {
+		cn, ok := dc.(*conn)
+		if !ok {
+			return errors.New("pq: connection is not a pq connection")
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		finish := cn.watchCancel(ctx)
+		defer finish()
+
+		st, err := cn.prepareTo(q, "")
+		if err != nil {
+			return err
+		}
+
+		rs, err := st.Query(args)
+		if err != nil {
+			return err
+		}
+		defer rs.Close()
+
+		dest := make([]driver.Value, 1)
+		if err := rs.Next(dest); err != nil {
+			if err == io.EOF {
+				return errors.New("pq: no result from " + q)
+			}
+			return err
+		}
+		v = dest[0]
+		return nil
+	})
+
+	if err != nil {
+		err = ctxErr(ctx, err)
+	}
+	return v, err
+}
@@ -0,0 +1,80 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAdvisoryLockKeyArgs(t *testing.T) {
+	params, args := Key(1 << 40).args()
+	if params != "($1)" || !reflect.DeepEqual(args, []driver.Value{int64(1 << 40)}) {
+		t.Errorf("unexpected args for Key: %s %v", params, args)
+	}
+
+	params, args = Key2(-1, 7).args()
+	if params != "($1, $2)" || !reflect.DeepEqual(args, []driver.Value{int64(-1), int64(7)}) {
+		t.Errorf("unexpected args for Key2: %s %v", params, args)
+	}
+}
+
+func TestAdvisoryLock(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	key := Key(0x7067676f74657374)
+	l1 := NewAdvisoryLock(db, key)
+	l2 := NewAdvisoryLock(db, key)
+
+	if err := l1.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l1.Lock(ctx); err != ErrLockHeld {
+		t.Fatalf("expected ErrLockHeld, got %v", err)
+	}
+
+	ok, err := l2.TryLock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected TryLock to fail while the lock is held elsewhere")
+	}
+
+	// A blocked Lock must be cancelled on the server when the
+	// context expires.
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := l2.Lock(tctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if err := l1.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Unlock(ctx); err != ErrLockNotHeld {
+		t.Fatalf("expected ErrLockNotHeld, got %v", err)
+	}
+
+	ok, err = l2.TryLockShared(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected TryLockShared to succeed")
+	}
+
+	if err := l1.LockShared(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []*AdvisoryLock{l1, l2} {
+		if err := l.Unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package pq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// parseArray splits the text form of a one-dimensional array, such as
+// {1,"a b",NULL}, into its elements, unquoting them. NULL elements are
+// returned as nil. Most types use ',' as delim; box uses ';'.
+func parseArray(src []byte, delim byte) ([][]byte, error) {
+	// Skip explicit bounds, as in [0:1]={a,b}.
+	if len(src) > 0 && src[0] == '[' {
+		i := bytes.IndexByte(src, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("pq: invalid array %q", src)
+		}
+		src = src[i+1:]
+	}
+
+	if len(src) < 2 || src[0] != '{' || src[len(src)-1] != '}' {
+		return nil, fmt.Errorf("pq: invalid array %q", src)
+	}
+	src = src[1 : len(src)-1]
+
+	elems := [][]byte{}
+	if len(src) == 0 {
+		return elems, nil
+	}
+
+	for i := 0; ; {
+		if i < len(src) && src[i] == '{' {
+			return nil, errors.New("pq: multidimensional arrays are not supported")
+		}
+
+		var elem []byte
+		if i < len(src) && src[i] == '"' {
+			elem = []byte{}
+			for i++; ; i++ {
+				if i >= len(src) {
+					return nil, fmt.Errorf("pq: unterminated quoted array element in %q", src)
+				}
+				c := src[i]
+				if c == '\\' && i+1 < len(src) {
+					i++
+					c = src[i]
+				} else if c == '"' {
+					i++
+					break
+				}
+				elem = append(elem, c)
+			}
+		} else {
+			j := bytes.IndexByte(src[i:], delim)
+			if j < 0 {
+				j = len(src) - i
+			}
+			elem = src[i : i+j]
+			i += j
+			if string(elem) == "NULL" {
+				elem = nil
+			}
+		}
+		elems = append(elems, elem)
+
+		if i == len(src) {
+			return elems, nil
+		}
+		if src[i] != delim {
+			return nil, fmt.Errorf("pq: invalid array %q", src)
+		}
+		i++
+	}
+}
+
+// appendArray appends the text form of a one-dimensional array of the
+// given elements to b, quoting every element. nil elements are NULL.
+func appendArray(b []byte, elems [][]byte, delim byte) []byte {
+	b = append(b, '{')
+	for i, e := range elems {
+		if i > 0 {
+			b = append(b, delim)
+		}
+
+		if e == nil {
+			b = append(b, "NULL"...)
+			continue
+		}
+
+		b = append(b, '"')
+		for _, c := range e {
+			if c == '"' || c == '\\' {
+				b = append(b, '\\')
+			}
+			b = append(b, c)
+		}
+		b = append(b, '"')
+	}
+	return append(b, '}')
+}
@@ -0,0 +1,225 @@
+package pq
+
+import (
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// typeNames holds the names reported by ColumnTypeDatabaseTypeName for
+// the built-in types; array types are named after their element type
+// with a leading underscore, as in pg_type.
+var typeNames = map[oid]string{
+	t_bool:        "BOOL",
+	t_bytea:       "BYTEA",
+	t_char:        "CHAR",
+	t_name:        "NAME",
+	t_int8:        "INT8",
+	t_int2:        "INT2",
+	t_int4:        "INT4",
+	t_text:        "TEXT",
+	t_oid:         "OID",
+	t_json:        "JSON",
+	t_xml:         "XML",
+	t_point:       "POINT",
+	t_lseg:        "LSEG",
+	t_path:        "PATH",
+	t_box:         "BOX",
+	t_polygon:     "POLYGON",
+	t_line:        "LINE",
+	t_float4:      "FLOAT4",
+	t_float8:      "FLOAT8",
+	t_unknown:     "UNKNOWN",
+	t_circle:      "CIRCLE",
+	t_money:       "MONEY",
+	t_macaddr:     "MACADDR",
+	t_macaddr8:    "MACADDR8",
+	t_inet:        "INET",
+	t_cidr:        "CIDR",
+	t_bpchar:      "BPCHAR",
+	t_varchar:     "VARCHAR",
+	t_date:        "DATE",
+	t_time:        "TIME",
+	t_timestamp:   "TIMESTAMP",
+	t_timestamptz: "TIMESTAMPTZ",
+	t_interval:    "INTERVAL",
+	t_timetz:      "TIMETZ",
+	t_bit:         "BIT",
+	t_varbit:      "VARBIT",
+	t_numeric:     "NUMERIC",
+	t_uuid:        "UUID",
+	t_jsonb:       "JSONB",
+	t_record:      "RECORD",
+	t_void:        "VOID",
+
+	t__bool:        "_BOOL",
+	t__bytea:       "_BYTEA",
+	t__char:        "_CHAR",
+	t__name:        "_NAME",
+	t__int2:        "_INT2",
+	t__int4:        "_INT4",
+	t__int8:        "_INT8",
+	t__text:        "_TEXT",
+	t__oid:         "_OID",
+	t__bpchar:      "_BPCHAR",
+	t__varchar:     "_VARCHAR",
+	t__float4:      "_FLOAT4",
+	t__float8:      "_FLOAT8",
+	t__date:        "_DATE",
+	t__time:        "_TIME",
+	t__timestamp:   "_TIMESTAMP",
+	t__timestamptz: "_TIMESTAMPTZ",
+	t__interval:    "_INTERVAL",
+	t__numeric:     "_NUMERIC",
+	t__timetz:      "_TIMETZ",
+	t__uuid:        "_UUID",
+	t__json:        "_JSON",
+	t__inet:        "_INET",
+	t__cidr:        "_CIDR",
+	t__macaddr:     "_MACADDR",
+	t__macaddr8:    "_MACADDR8",
+	t__jsonb:       "_JSONB",
+
+	t_int4range:      "INT4RANGE",
+	t_int8range:      "INT8RANGE",
+	t_numrange:       "NUMRANGE",
+	t_tsrange:        "TSRANGE",
+	t_tstzrange:      "TSTZRANGE",
+	t_daterange:      "DATERANGE",
+	t_int4multirange: "INT4MULTIRANGE",
+	t_int8multirange: "INT8MULTIRANGE",
+	t_nummultirange:  "NUMMULTIRANGE",
+	t_tsmultirange:   "TSMULTIRANGE",
+	t_tstzmultirange: "TSTZMULTIRANGE",
+	t_datemultirange: "DATEMULTIRANGE",
+}
+
+var (
+	scanTypeBool    = reflect.TypeOf(false)
+	scanTypeInt64   = reflect.TypeOf(int64(0))
+	scanTypeFloat64 = reflect.TypeOf(float64(0))
+	scanTypeTime    = reflect.TypeOf(time.Time{})
+	scanTypeBytes   = reflect.TypeOf([]byte(nil))
+	scanTypeInet    = reflect.TypeOf(Inet{})
+	scanTypeIPNet   = reflect.TypeOf((*net.IPNet)(nil))
+	scanTypeMACAddr = reflect.TypeOf(net.HardwareAddr(nil))
+)
+
+// ColumnTypeDatabaseTypeName implements
+// driver.RowsColumnTypeDatabaseTypeName. It returns "" for types it
+// does not know by name, such as extension and user-defined types,
+// unless they were registered by name with RegisterType.
+func (rs *rows) ColumnTypeDatabaseTypeName(i int) string {
+	typ := rs.st.rowTyps[i]
+	if n, ok := typeNames[typ]; ok {
+		return n
+	}
+	return strings.ToUpper(rs.st.cn.types[typ].name)
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType,
+// returning the type of the values decoded for the column. The values
+// of inet columns are either a net.IP or a *net.IPNet, so for those it
+// returns Inet, which accepts both.
+func (rs *rows) ColumnTypeScanType(i int) reflect.Type {
+	switch rs.st.rowTyps[i] {
+	case t_bool:
+		return scanTypeBool
+	case t_int8, t_int4, t_int2:
+		return scanTypeInt64
+	case t_float4, t_float8:
+		return scanTypeFloat64
+	case t_timestamptz, t_timestamp, t_time, t_timetz, t_date:
+		return scanTypeTime
+	case t_inet:
+		return scanTypeInet
+	case t_cidr:
+		return scanTypeIPNet
+	case t_macaddr, t_macaddr8:
+		return scanTypeMACAddr
+	}
+	// Everything else, text included, is decoded as []byte.
+	return scanTypeBytes
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength. Text and
+// bytea columns are unbounded; varchar(n) and char(n) report n.
+func (rs *rows) ColumnTypeLength(i int) (length int64, ok bool) {
+	f := rs.field(i)
+	switch f.typ {
+	case t_text, t_bytea:
+		return math.MaxInt64, true
+	case t_varchar, t_bpchar:
+		if f.mod < 4 {
+			return math.MaxInt64, true
+		}
+		return int64(f.mod - 4), true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale implements
+// driver.RowsColumnTypePrecisionScale, decoding the type modifier of
+// numeric(p, s), and the fractional second precision of time,
+// timestamp and interval types.
+func (rs *rows) ColumnTypePrecisionScale(i int) (precision, scale int64, ok bool) {
+	f := rs.field(i)
+	switch f.typ {
+	case t_numeric:
+		if f.mod < 4 {
+			return 0, 0, false
+		}
+		// Since 15 the scale may be negative, in 11 bits.
+		mod := f.mod - 4
+		return int64(mod >> 16 & 0xffff), int64((mod&0x7ff ^ 1024) - 1024), true
+	case t_time, t_timetz, t_timestamp, t_timestamptz:
+		if f.mod < 0 {
+			// unconstrained, that is microseconds
+			return 6, 0, true
+		}
+		return int64(f.mod), 0, true
+	case t_interval:
+		if f.mod < 0 || f.mod&0xffff == 0xffff {
+			return 6, 0, true
+		}
+		return int64(f.mod & 0xffff), 0, true
+	}
+	return 0, 0, false
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable. The
+// server does not report whether result columns can be null, so this
+// is always unknown. For a column taken from a table it could be read
+// from pg_attribute.attnotnull, but not on the connection the rows
+// are still being read from; ColumnOrigin gives what such a lookup
+// needs.
+func (rs *rows) ColumnTypeNullable(i int) (nullable, ok bool) {
+	return false, false
+}
+
+// ColumnOriginer is implemented by the driver.Rows that pq returns,
+// which (*sql.Conn).Raw gives access to.
+type ColumnOriginer interface {
+	// ColumnOrigin returns the OID of the table that result column
+	// i comes from and the column's attribute number, pg_attribute's
+	// attrelid and attnum. Both are zero if the column is not taken
+	// directly from a table.
+	ColumnOrigin(i int) (table uint32, column int)
+}
+
+// ColumnOrigin implements ColumnOriginer.
+func (rs *rows) ColumnOrigin(i int) (table uint32, column int) {
+	f := rs.field(i)
+	return uint32(f.table), f.column
+}
+
+// field returns the description of column i. Descriptions are missing
+// only for columns of a stmt that was never described.
+func (rs *rows) field(i int) fieldDesc {
+	if i < len(rs.st.fields) {
+		return rs.st.fields[i]
+	}
+	return fieldDesc{typ: rs.st.rowTyps[i], len: -1, mod: -1}
+}
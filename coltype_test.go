@@ -0,0 +1,128 @@
+package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestColumnTypeModifiers(t *testing.T) {
+	rs := &rows{st: &stmt{
+		rowTyps: []oid{t_varchar, t_numeric, t_numeric, t_timestamptz, t_text, t_int4},
+		fields: []fieldDesc{
+			{typ: t_varchar, len: -1, mod: 24},
+			{typ: t_numeric, len: -1, mod: 10<<16 | 2 + 4},
+			{typ: t_numeric, len: -1, mod: -1},
+			{typ: t_timestamptz, len: 8, mod: 3},
+			{typ: t_text, len: -1, mod: -1},
+			{table: 16390, column: 2, typ: t_int4, len: 4, mod: -1},
+		},
+	}}
+
+	if table, column := rs.ColumnOrigin(5); table != 16390 || column != 2 {
+		t.Errorf("expected column 2 of table 16390, got %d of %d", column, table)
+	}
+	if table, column := rs.ColumnOrigin(0); table != 0 || column != 0 {
+		t.Errorf("expected no table column, got %d of %d", column, table)
+	}
+
+	if n, ok := rs.ColumnTypeLength(0); !ok || n != 20 {
+		t.Errorf("varchar(20): expected length 20, got %d, %v", n, ok)
+	}
+	if n, ok := rs.ColumnTypeLength(4); !ok || n != math.MaxInt64 {
+		t.Errorf("text: expected unbounded length, got %d, %v", n, ok)
+	}
+	if _, ok := rs.ColumnTypeLength(5); ok {
+		t.Error("int4: expected no length")
+	}
+
+	if p, s, ok := rs.ColumnTypePrecisionScale(1); !ok || p != 10 || s != 2 {
+		t.Errorf("numeric(10,2): got %d, %d, %v", p, s, ok)
+	}
+	if _, _, ok := rs.ColumnTypePrecisionScale(2); ok {
+		t.Error("numeric: expected no precision")
+	}
+	if p, _, ok := rs.ColumnTypePrecisionScale(3); !ok || p != 3 {
+		t.Errorf("timestamptz(3): got %d, %v", p, ok)
+	}
+
+	if name := rs.ColumnTypeDatabaseTypeName(1); name != "NUMERIC" {
+		t.Errorf("expected NUMERIC, got %q", name)
+	}
+	if typ := rs.ColumnTypeScanType(5); typ != scanTypeInt64 {
+		t.Errorf("int4: expected int64 scan type, got %v", typ)
+	}
+
+	// Values of these types are decoded as they are sent.
+	rs = &rows{st: &stmt{rowTyps: []oid{t_text, t_varchar, t_bpchar, t_name, t_uuid}}}
+	for i, typ := range rs.st.rowTyps {
+		if st := rs.ColumnTypeScanType(i); st != scanTypeBytes {
+			t.Errorf("%s: expected []byte scan type, got %v", rs.ColumnTypeDatabaseTypeName(i), st)
+		}
+		if _, ok := decode([]byte("x"), typ).([]byte); !ok {
+			t.Errorf("%s: expected []byte value", rs.ColumnTypeDatabaseTypeName(i))
+		}
+	}
+
+	// Network address values are decoded as the net types, which the
+	// scan type of their column accepts.
+	rs = &rows{st: &stmt{rowTyps: []oid{t_inet, t_inet, t_cidr, t_macaddr, t_macaddr8}}}
+	for i, s := range []string{"10.0.0.1", "10.1.2.3/8", "10.0.0.0/8", "08:00:2b:01:02:03", "08:00:2b:ff:fe:01:02:03"} {
+		v := decode([]byte(s), rs.st.rowTyps[i])
+		dest := reflect.New(rs.ColumnTypeScanType(i))
+		if sc, ok := dest.Interface().(sql.Scanner); ok {
+			if err := sc.Scan(v); err != nil {
+				t.Errorf("%s: %v", s, err)
+			}
+		} else if reflect.TypeOf(v) != dest.Elem().Type() {
+			t.Errorf("%s: expected %v value, got %T", s, dest.Elem().Type(), v)
+			continue
+		} else {
+			dest.Elem().Set(reflect.ValueOf(v))
+		}
+		if got := fmt.Sprint(dest.Elem().Interface()); got != s {
+			t.Errorf("%s: scanned %s", s, got)
+		}
+	}
+
+	var rsi driver.Rows = rs
+	if _, ok := rsi.(driver.RowsColumnTypeNullable); !ok {
+		t.Error("rows don't implement RowsColumnTypeNullable")
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	r, err := db.Query("SELECT 'a'::varchar(5), 1.5::numeric(6,3), now()::timestamp(2), 1::int8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cts, err := r.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"VARCHAR", "NUMERIC", "TIMESTAMP", "INT8"}
+	for i, ct := range cts {
+		if ct.DatabaseTypeName() != names[i] {
+			t.Errorf("column %d: expected %s, got %s", i, names[i], ct.DatabaseTypeName())
+		}
+	}
+
+	if n, ok := cts[0].Length(); !ok || n != 5 {
+		t.Errorf("expected length 5, got %d, %v", n, ok)
+	}
+	if p, s, ok := cts[1].DecimalSize(); !ok || p != 6 || s != 3 {
+		t.Errorf("expected numeric(6,3), got %d, %d, %v", p, s, ok)
+	}
+	if p, _, ok := cts[2].DecimalSize(); !ok || p != 2 {
+		t.Errorf("expected timestamp(2), got %d, %v", p, ok)
+	}
+}
@@ -0,0 +1,690 @@
+package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Composite is a value of a composite type or of type record: its
+// fields in order, nil for NULL.
+//
+// A Composite scans from the text format, which gives each field as
+// the []byte of its text and no names, and from the binary format,
+// whose fields are decoded by the type the value gives for each; those
+// that pq cannot decode in binary are left as their bytes. Values of a
+// type registered with RegisterComposite are decoded to a Composite
+// with the attribute names, and each field decoded as a column of its
+// attribute's type would be.
+//
+// A Composite with nil Fields is NULL.
+type Composite struct {
+	Names  []string
+	Fields []interface{}
+}
+
+// Scan implements the sql.Scanner interface.
+func (c *Composite) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*c = Composite{}
+		return nil
+	case Composite:
+		*c = src
+		return nil
+	case string:
+		return c.Scan([]byte(src))
+	case []byte:
+		if len(src) > 0 && src[0] != '(' {
+			return c.UnmarshalBinary(src)
+		}
+		fields, err := parseComposite(src)
+		if err != nil {
+			return err
+		}
+		*c = Composite{Fields: make([]interface{}, len(fields))}
+		for i, f := range fields {
+			if f != nil {
+				c.Fields[i] = f
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("pq: cannot convert %T to Composite", src)
+}
+
+// Value implements the driver.Valuer interface, sending the fields in
+// order in the text format.
+func (c Composite) Value() (driver.Value, error) {
+	if c.Fields == nil {
+		return nil, nil
+	}
+	fields := make([][]byte, len(c.Fields))
+	for i, v := range c.Fields {
+		b, err := compositeFieldText(v, t_unknown)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = b
+	}
+	return string(appendComposite(nil, fields)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler for the binary
+// format of composite types and records. Timestamp fields are read as
+// UTC, as decode reads them without the timestamp_zone option.
+func (c *Composite) UnmarshalBinary(data []byte) error {
+	return c.unmarshalBinary(data, nil)
+}
+
+// unmarshalBinary is UnmarshalBinary with timestamp fields read in loc,
+// if it is not nil.
+func (c *Composite) unmarshalBinary(data []byte, loc *time.Location) error {
+	if len(data) < 4 {
+		return errors.New("pq: invalid binary composite")
+	}
+	n := int(int32(binary.BigEndian.Uint32(data)))
+	data = data[4:]
+	if n < 0 || n > len(data)/8 {
+		return errors.New("pq: invalid binary composite")
+	}
+
+	fields := make([]interface{}, n)
+	for i := range fields {
+		if len(data) < 8 {
+			return errors.New("pq: invalid binary composite")
+		}
+		typ := oid(binary.BigEndian.Uint32(data))
+		l := int(int32(binary.BigEndian.Uint32(data[4:])))
+		data = data[8:]
+		if l < 0 {
+			continue
+		}
+		if l > len(data) {
+			return errors.New("pq: invalid binary composite")
+		}
+		v, err := decodeBinary(data[:l], typ, loc)
+		if err != nil {
+			return err
+		}
+		fields[i] = v
+		data = data[l:]
+	}
+	if len(data) != 0 {
+		return errors.New("pq: invalid binary composite")
+	}
+
+	*c = Composite{Fields: fields}
+	return nil
+}
+
+// decodeBinary decodes a field of a binary composite as decode would
+// decode its text, or returns its bytes for types it does not know.
+// Timestamp values are read in loc, as cn.decode does, if it is not
+// nil.
+func decodeBinary(b []byte, typ oid, loc *time.Location) (interface{}, error) {
+	fixed := func(n int) error {
+		if len(b) != n {
+			return fmt.Errorf("pq: invalid binary %s", typeNames[typ])
+		}
+		return nil
+	}
+	switch typ {
+	case t_bool:
+		if err := fixed(1); err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case t_int2:
+		if err := fixed(2); err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case t_int4:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	case t_int8:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case t_float4:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case t_float8:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case t_date:
+		if err := fixed(4); err != nil {
+			return nil, err
+		}
+		days := int32(binary.BigEndian.Uint32(b))
+		if days == math.MinInt32 || days == math.MaxInt32 {
+			return binaryInfinityValue(days > 0), nil
+		}
+		return pgEpoch.AddDate(0, 0, int(days)), nil
+	case t_timestamp, t_timestamptz:
+		if err := fixed(8); err != nil {
+			return nil, err
+		}
+		usec := int64(binary.BigEndian.Uint64(b))
+		if usec == math.MinInt64 || usec == math.MaxInt64 {
+			return binaryInfinityValue(usec > 0), nil
+		}
+		// Beyond the range of a time.Duration from pgEpoch.
+		t := time.Unix(pgEpoch.Unix()+usec/1e6, usec%1e6*1e3).UTC()
+		if typ == t_timestamp && loc != nil {
+			t = wallClockIn(t, loc)
+		}
+		return t, nil
+	case t_uuid:
+		var u UUID
+		if err := u.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+		return u.appendText(nil), nil
+	case t_inet, t_cidr:
+		var i Inet
+		if err := i.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+		return i.decoded(typ), nil
+	case t_macaddr, t_macaddr8:
+		var m MACAddr
+		if err := m.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+		return net.HardwareAddr(m), nil
+	case t_record:
+		var c Composite
+		if err := c.unmarshalBinary(b, loc); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// binaryInfinityValue returns what decode returns for the text of an
+// infinite date or timestamp.
+func binaryInfinityValue(positive bool) interface{} {
+	s := "-infinity"
+	if positive {
+		s = "infinity"
+	}
+	v, _ := decodeInfinity([]byte(s))
+	return v
+}
+
+// parseComposite parses the text format of a composite value. An
+// unquoted empty field is NULL, and is returned as nil.
+func parseComposite(src []byte) ([][]byte, error) {
+	if len(src) < 2 || src[0] != '(' || src[len(src)-1] != ')' {
+		return nil, fmt.Errorf("pq: invalid composite %q", src)
+	}
+	s := src[1 : len(src)-1]
+
+	fields := [][]byte{}
+	if len(s) == 0 {
+		// A composite of no fields; one of a single NULL field is
+		// written the same way.
+		return fields, nil
+	}
+	for {
+		var f []byte
+		quoted := false
+		for len(s) > 0 && s[0] != ',' {
+			switch s[0] {
+			case '"':
+				quoted = true
+				s = s[1:]
+				for {
+					if len(s) == 0 {
+						return nil, fmt.Errorf("pq: invalid composite %q", src)
+					}
+					if s[0] == '"' {
+						if len(s) > 1 && s[1] == '"' {
+							f = append(f, '"')
+							s = s[2:]
+							continue
+						}
+						s = s[1:]
+						break
+					}
+					if s[0] == '\\' && len(s) > 1 {
+						s = s[1:]
+					}
+					f = append(f, s[0])
+					s = s[1:]
+				}
+			case '\\':
+				if len(s) < 2 {
+					return nil, fmt.Errorf("pq: invalid composite %q", src)
+				}
+				f = append(f, s[1])
+				s = s[2:]
+			default:
+				f = append(f, s[0])
+				s = s[1:]
+			}
+		}
+		if f == nil && quoted {
+			f = []byte{}
+		}
+		fields = append(fields, f)
+		if len(s) == 0 {
+			return fields, nil
+		}
+		s = s[1:]
+	}
+}
+
+// appendComposite appends the text format of a composite value with
+// the given fields, quoting every field but NULLs, which are nil.
+func appendComposite(b []byte, fields [][]byte) []byte {
+	b = append(b, '(')
+	for i, f := range fields {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if f == nil {
+			continue
+		}
+		b = append(b, '"')
+		for _, c := range f {
+			if c == '"' || c == '\\' {
+				b = append(b, c)
+			}
+			b = append(b, c)
+		}
+		b = append(b, '"')
+	}
+	return append(b, ')')
+}
+
+// compositeFieldText returns the text of a field of a composite value
+// of type typ, which may be unknown, or nil for NULL.
+func compositeFieldText(v interface{}, typ oid) (b []byte, err error) {
+	defer errRecover(&err)
+
+	if f, ok := v.(float64); ok {
+		return strconv.AppendFloat(nil, f, 'g', -1, 64), nil
+	}
+	cv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if cv == nil {
+		return nil, nil
+	}
+	b = encode(cv, typ)
+	if b == nil {
+		b = []byte{}
+	}
+	return b, nil
+}
+
+// CompositeStruct scans a composite value or record into the struct
+// V points to, and sends V, a struct or a pointer to one, as a
+// composite parameter.
+//
+// The fields of the struct are matched to the fields of the value in
+// order, skipping unexported fields and those tagged `pq:"-"`. When
+// the value has attribute names, as it does for a type registered with
+// RegisterComposite, and the struct tags any field with a name, as in
+// `pq:"street"`, fields are instead matched by name: the tagged name or
+// the field's name, compared without regard to case. A parameter of a
+// registered type is sent with its attributes matched by name in the
+// same way, and those with no field as NULL.
+//
+// Fields are set from text as Scan on an sql.Rows sets them, allowing
+// pointers for NULL, sql.Scanner implementations and nested structs
+// for nested composites. A NULL composite sets the struct to its zero
+// value, and a nil pointer is sent as NULL.
+type CompositeStruct struct {
+	V interface{}
+}
+
+// null reports whether V is a nil pointer, which is sent as NULL.
+func (cs CompositeStruct) null() bool {
+	v := reflect.ValueOf(cs.V)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	return false
+}
+
+// Scan implements the sql.Scanner interface.
+func (cs CompositeStruct) Scan(src interface{}) error {
+	dst := reflect.ValueOf(cs.V)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() || dst.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("pq: CompositeStruct needs a pointer to a struct, not %T", cs.V)
+	}
+	var c Composite
+	if err := c.Scan(src); err != nil {
+		return err
+	}
+	return scanStruct(dst.Elem(), c)
+}
+
+// Value implements the driver.Valuer interface, sending the fields of
+// the struct in order in the text format.
+func (cs CompositeStruct) Value() (driver.Value, error) {
+	c, err := cs.composite(nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Value()
+}
+
+// composite returns the fields of the struct as a composite value with
+// the given attribute names, or in order if there are none.
+func (cs CompositeStruct) composite(names []string) (Composite, error) {
+	v := reflect.ValueOf(cs.V)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return Composite{}, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return Composite{}, fmt.Errorf("pq: CompositeStruct needs a struct, not %T", cs.V)
+	}
+
+	fs, byName := structFields(v.Type())
+	var idx []int
+	if names != nil && byName {
+		idx = make([]int, len(names))
+		for i, n := range names {
+			idx[i] = -1
+			for j, f := range fs {
+				if strings.EqualFold(f.name, n) {
+					idx[i] = j
+				}
+			}
+		}
+	} else {
+		if names != nil && len(names) != len(fs) {
+			return Composite{}, fmt.Errorf("pq: composite has %d fields, struct has %d", len(names), len(fs))
+		}
+		idx = make([]int, len(fs))
+		for i := range idx {
+			idx[i] = i
+		}
+	}
+
+	c := Composite{Fields: make([]interface{}, len(idx))}
+	for i, j := range idx {
+		if j < 0 {
+			continue
+		}
+		fv := v.FieldByIndex(fs[j].index)
+		if isNestedStruct(fv.Type()) {
+			c.Fields[i] = CompositeStruct{V: fv.Interface()}
+			continue
+		}
+		c.Fields[i] = fv.Interface()
+	}
+	return c, nil
+}
+
+// structField is a field of a struct mapped to a composite field.
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields returns the fields of struct type t that map to
+// composite fields, and whether any is tagged with a name.
+func structFields(t reflect.Type) (fs []structField, tagged bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("pq"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name, tagged = tag, true
+		}
+		fs = append(fs, structField{name: name, index: f.Index})
+	}
+	return fs, tagged
+}
+
+// isNestedStruct reports whether a field of type t holds a nested
+// composite rather than a value that scans itself.
+func isNestedStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	return !pt.Implements(reflect.TypeOf((*sql.Scanner)(nil)).Elem()) &&
+		!t.Implements(reflect.TypeOf((*driver.Valuer)(nil)).Elem())
+}
+
+// scanStruct sets the fields of the struct v from c.
+func scanStruct(v reflect.Value, c Composite) error {
+	if c.Fields == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	fs, byName := structFields(v.Type())
+	if len(c.Fields) == 0 && len(fs) == 1 {
+		// "()" is also the text of a single NULL field.
+		c.Fields = []interface{}{nil}
+	}
+	if c.Names != nil && byName {
+		for i, n := range c.Names {
+			for _, f := range fs {
+				if strings.EqualFold(f.name, n) {
+					if err := scanField(v.FieldByIndex(f.index), c.Fields[i]); err != nil {
+						return fmt.Errorf("pq: composite field %s: %v", n, err)
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	if len(fs) != len(c.Fields) {
+		return fmt.Errorf("pq: composite has %d fields, struct has %d", len(c.Fields), len(fs))
+	}
+	for i, f := range fs {
+		if err := scanField(v.FieldByIndex(f.index), c.Fields[i]); err != nil {
+			return fmt.Errorf("pq: composite field %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// scanField sets the struct field dst from src, a field as decoded in
+// a Composite.
+func scanField(dst reflect.Value, src interface{}) (err error) {
+	defer errRecover(&err)
+
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if s, ok := dst.Addr().Interface().(sql.Scanner); ok {
+		return s.Scan(src)
+	}
+	if dst.Kind() == reflect.Ptr {
+		p := reflect.New(dst.Type().Elem())
+		if err := scanField(p.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	}
+
+	if dst.Kind() == reflect.Struct && dst.Type() != reflect.TypeOf(time.Time{}) {
+		var c Composite
+		if err := c.Scan(src); err != nil {
+			return err
+		}
+		return scanStruct(dst, c)
+	}
+
+	b, isText := src.([]byte)
+	switch dst.Kind() {
+	case reflect.String:
+		if isText {
+			dst.SetString(string(b))
+			return nil
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 && isText {
+			dst.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+	case reflect.Bool:
+		if isText {
+			v, err := strconv.ParseBool(string(b))
+			if err != nil {
+				return err
+			}
+			dst.SetBool(v)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if isText {
+			n, err := strconv.ParseInt(string(b), 10, dst.Type().Bits())
+			if err != nil {
+				return err
+			}
+			dst.SetInt(n)
+			return nil
+		}
+		if n, ok := src.(int64); ok && !dst.OverflowInt(n) {
+			dst.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if isText {
+			n, err := strconv.ParseUint(string(b), 10, dst.Type().Bits())
+			if err != nil {
+				return err
+			}
+			dst.SetUint(n)
+			return nil
+		}
+		if n, ok := src.(int64); ok && n >= 0 && !dst.OverflowUint(uint64(n)) {
+			dst.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if isText {
+			f, err := strconv.ParseFloat(string(b), dst.Type().Bits())
+			if err != nil {
+				return err
+			}
+			dst.SetFloat(f)
+			return nil
+		}
+	case reflect.Struct:
+		if isText {
+			t, ok := decode(b, rangeTimeType(b)).(time.Time)
+			if !ok {
+				return fmt.Errorf("cannot scan %q into time.Time; see EnableInfinityTs", b)
+			}
+			src = t
+		}
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().ConvertibleTo(dst.Type()) && sv.Kind() == dst.Kind() {
+		dst.Set(sv.Convert(dst.Type()))
+		return nil
+	}
+	if sv.Kind() == reflect.Float64 && (dst.Kind() == reflect.Float32 || dst.Kind() == reflect.Float64) {
+		dst.SetFloat(sv.Float())
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into %s", src, dst.Type())
+}
+
+// encodeComposite encodes x, a parameter of the registered composite
+// type r, encoding each field by its attribute's type.
+func encodeComposite(x interface{}, r registeredType) []byte {
+	var c Composite
+	switch v := x.(type) {
+	case CompositeStruct:
+		var err error
+		if c, err = v.composite(r.attNames); err != nil {
+			panic(err)
+		}
+	default:
+		return encode(x, r.oid)
+	}
+	if len(c.Fields) != len(r.attTypes) {
+		errorf("encode %s: %d fields for %d attributes", r, len(c.Fields), len(r.attTypes))
+	}
+
+	fields := make([][]byte, len(c.Fields))
+	for i, v := range c.Fields {
+		b, err := compositeFieldText(v, r.attTypes[i])
+		if err != nil {
+			panic(err)
+		}
+		fields[i] = b
+	}
+	return appendComposite(nil, fields)
+}
+
+// decodeComposite decodes a value of the registered composite type r,
+// decoding each field by its attribute's type. Values in the binary
+// format, told apart as in Composite.Scan, carry the types of their
+// fields themselves.
+func (cn *conn) decodeComposite(s []byte, r registeredType) Composite {
+	if len(s) > 0 && s[0] != '(' {
+		var c Composite
+		if err := c.unmarshalBinary(s, cn.timestampLocation()); err != nil {
+			panic(err)
+		}
+		c.Names = r.attNames
+		return c
+	}
+
+	fields, err := parseComposite(s)
+	if err != nil {
+		panic(err)
+	}
+	if len(fields) == 0 && len(r.attTypes) == 1 {
+		fields = [][]byte{nil}
+	}
+	if len(fields) != len(r.attTypes) {
+		errorf("decode %s: %d fields for %d attributes", r, len(fields), len(r.attTypes))
+	}
+
+	c := Composite{Names: r.attNames, Fields: make([]interface{}, len(fields))}
+	for i, f := range fields {
+		if f != nil {
+			c.Fields[i] = cn.decode(f, r.attTypes[i])
+		}
+	}
+	return c
+}
@@ -0,0 +1,361 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseComposite(t *testing.T) {
+	for in, want := range map[string][][]byte{
+		`()`:                    {},
+		`(1,abc)`:               {[]byte("1"), []byte("abc")},
+		`(,"")`:                 {nil, []byte("")},
+		`("a ""b"" c",d\,e)`:    {[]byte(`a "b" c`), []byte("d,e")},
+		`("x\\y\"z",)`:          {[]byte(`x\y"z`), nil},
+		`("(1,2)",ab"c,d"e)`:    {[]byte("(1,2)"), []byte("abc,de")},
+		`(" leading space ")`:   {[]byte(" leading space ")},
+		`(2001-02-03 04:05:06)`: {[]byte("2001-02-03 04:05:06")},
+	} {
+		got, err := parseComposite([]byte(in))
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %q, got %q", in, want, got)
+		}
+		if in == `()` {
+			continue
+		}
+		back, _ := parseComposite(appendComposite(nil, got))
+		if !reflect.DeepEqual(back, want) {
+			t.Errorf("%s: round trip gave %q", in, back)
+		}
+	}
+
+	for _, in := range []string{"", "(", "1,2", `("a)`, `(a\)`} {
+		if _, err := parseComposite([]byte(in)); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func TestCompositeScanValue(t *testing.T) {
+	var c Composite
+	if err := c.Scan(`(1,,"a b")`); err != nil {
+		t.Fatal(err)
+	}
+	want := Composite{Fields: []interface{}{[]byte("1"), nil, []byte("a b")}}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("expected %v, got %v", want, c)
+	}
+
+	c = Composite{Fields: []interface{}{int64(1), nil, "a\"b", 1.5, true, time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)}}
+	if v, _ := c.Value(); v != `("1",,"a""b","1.5","true","2001-02-03 00:00:00Z")` {
+		t.Errorf("unexpected %v", v)
+	}
+
+	if err := c.Scan(nil); err != nil || c.Fields != nil {
+		t.Errorf("expected NULL, got %v, %v", c, err)
+	}
+	if v, _ := c.Value(); v != nil {
+		t.Errorf("expected NULL, got %v", v)
+	}
+}
+
+func TestCompositeBinary(t *testing.T) {
+	field := func(b []byte, typ oid, data []byte) []byte {
+		b = binary.BigEndian.AppendUint32(b, uint32(typ))
+		if data == nil {
+			return binary.BigEndian.AppendUint32(b, 0xffffffff)
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+		return append(b, data...)
+	}
+
+	inner := binary.BigEndian.AppendUint32(nil, 1)
+	inner = field(inner, t_bool, []byte{1})
+
+	b := binary.BigEndian.AppendUint32(nil, 8)
+	b = field(b, t_int4, []byte{0xff, 0xff, 0xff, 0xfe})
+	b = field(b, t_text, []byte("abc"))
+	b = field(b, t_int8, nil)
+	b = field(b, t_timestamptz, binary.BigEndian.AppendUint64(nil, uint64(86400e6+500)))
+	b = field(b, t_record, inner)
+	b = field(b, t_point, make([]byte, 16))
+	b = field(b, t_inet, []byte{pgAFInet, 8, 0, 4, 10, 1, 2, 3})
+	b = field(b, t_macaddr, []byte{8, 0, 0x2b, 1, 2, 3})
+
+	var c Composite
+	if err := c.Scan(b); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		int64(-2),
+		[]byte("abc"),
+		nil,
+		time.Date(2000, 1, 2, 0, 0, 0, 500000, time.UTC),
+		Composite{Fields: []interface{}{true}},
+		make([]byte, 16),
+		&net.IPNet{IP: net.IP{10, 1, 2, 3}, Mask: net.CIDRMask(8, 32)},
+		net.HardwareAddr{8, 0, 0x2b, 1, 2, 3},
+	}
+	if !reflect.DeepEqual(c.Fields, want) {
+		t.Errorf("expected %v, got %v", want, c.Fields)
+	}
+
+	for _, bad := range [][]byte{b[:len(b)-1], append(b, 0), {0, 0, 0}, {0, 0, 0, 1}} {
+		if err := c.UnmarshalBinary(bad); err == nil {
+			t.Errorf("%x: expected error", bad)
+		}
+	}
+}
+
+func TestCompositeBinaryTimes(t *testing.T) {
+	defer disableInfinityTs()
+	b := binary.BigEndian.AppendUint32(nil, 3)
+	for _, f := range []struct {
+		typ  oid
+		data []byte
+	}{
+		{t_date, binary.BigEndian.AppendUint32(nil, math.MaxInt32)},
+		{t_timestamptz, binary.BigEndian.AppendUint64(nil, math.MaxInt64)},
+		{t_timestamp, binary.BigEndian.AppendUint64(nil, 86400e6)},
+	} {
+		b = binary.BigEndian.AppendUint32(b, uint32(f.typ))
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f.data)))
+		b = append(b, f.data...)
+	}
+	// A negative infinite timestamp is the smallest int64.
+	neg := binary.BigEndian.AppendUint32(nil, 1)
+	neg = binary.BigEndian.AppendUint32(neg, t_timestamp)
+	neg = binary.BigEndian.AppendUint32(neg, 8)
+	neg = binary.BigEndian.AppendUint64(neg, 1<<63)
+
+	// Without EnableInfinityTs, infinities are their text, as in decode.
+	var c Composite
+	if err := c.Scan(b); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)
+	want := []interface{}{[]byte("infinity"), []byte("infinity"), day}
+	if !reflect.DeepEqual(c.Fields, want) {
+		t.Errorf("expected %v, got %v", want, c.Fields)
+	}
+
+	EnableInfinityTs(time.Date(-1, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(300000, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := c.Scan(b); err != nil {
+		t.Fatal(err)
+	}
+	want = []interface{}{infinityTsPositive, infinityTsPositive, day}
+	if !reflect.DeepEqual(c.Fields, want) {
+		t.Errorf("expected %v, got %v", want, c.Fields)
+	}
+	if err := c.Scan(neg); err != nil {
+		t.Fatal(err)
+	}
+	if v := c.Fields[0]; v != infinityTsNegative {
+		t.Errorf("expected -infinity, got %v", v)
+	}
+
+	// Registered composites honour timestamp_zone.
+	cn := &conn{timestampZone: "session", parameterStatus: map[string]string{"TimeZone": "JST-9"}}
+	r := registeredType{name: "times", oid: 16401, composite: true, attNames: []string{"d", "tstz", "ts"}}
+	cn.types = map[oid]registeredType{r.oid: r}
+	c = cn.decode(b, r.oid).(Composite)
+	ts := c.Fields[2].(time.Time)
+	if _, off := ts.Zone(); off != 9*3600 || ts.Day() != 2 || ts.Hour() != 0 {
+		t.Errorf("expected midnight in JST, got %v", ts)
+	}
+	if !reflect.DeepEqual(c.Names, r.attNames) {
+		t.Errorf("unexpected names %v", c.Names)
+	}
+}
+
+type testAddress struct {
+	Street string
+	Number *int
+	Since  time.Time
+	secret int
+}
+
+type testPerson struct {
+	Name    string `pq:"full_name"`
+	Age     int16
+	Skip    string `pq:"-"`
+	Address testAddress
+	ID      UUID
+}
+
+func TestCompositeStruct(t *testing.T) {
+	var p testPerson
+	err := CompositeStruct{&p}.Scan(`("Ann ""A""",42,"(""Main St"",,""2020-01-02 03:04:05"")",a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != `Ann "A"` || p.Age != 42 || p.Address.Street != "Main St" || p.Address.Number != nil ||
+		!p.Address.Since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) || p.ID.String() != "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11" {
+		t.Errorf("unexpected %+v", p)
+	}
+
+	n := 7
+	p.Address.Number = &n
+	p.Address.Since = p.Address.Since.In(time.FixedZone("", 3600))
+	v, err := CompositeStruct{p}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `("Ann ""A""","42","(""Main St"",""7"",""2020-01-02 04:04:05+01:00:00"")","a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")`
+	if v != want {
+		t.Errorf("expected %s, got %v", want, v)
+	}
+
+	var back testPerson
+	if err := (CompositeStruct{&back}).Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if back.Name != p.Name || *back.Address.Number != 7 || !back.Address.Since.Equal(p.Address.Since) {
+		t.Errorf("unexpected %+v", back)
+	}
+
+	// Fields are matched by name when the names are known.
+	c := Composite{
+		Names:  []string{"age", "full_name", "other"},
+		Fields: []interface{}{int64(30), []byte("Bob"), []byte("x")},
+	}
+	if err := (CompositeStruct{&back}).Scan(c); err != nil {
+		t.Fatal(err)
+	}
+	if back.Name != "Bob" || back.Age != 30 {
+		t.Errorf("unexpected %+v", back)
+	}
+
+	for _, c := range []struct {
+		dst interface{}
+		src interface{}
+	}{
+		{&back, `(a,b)`},
+		{&back, `(a,100000,"(x,,2020-01-01)",a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11)`},
+		{back, `(a,1,"(x,,2020-01-01)",a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11)`},
+		{&n, `(1)`},
+	} {
+		if err := (CompositeStruct{c.dst}).Scan(c.src); err == nil {
+			t.Errorf("%v: expected error", c.src)
+		}
+	}
+
+	if err := (CompositeStruct{&back}).Scan(nil); err != nil || back.Name != "" {
+		t.Errorf("expected zero value, got %+v, %v", back, err)
+	}
+}
+
+func TestRegisteredComposite(t *testing.T) {
+	cn := &conn{}
+	r := registeredType{
+		name:      "person",
+		oid:       16400,
+		composite: true,
+		attNames:  []string{"id", "full_name", "age", "photo"},
+		attTypes:  []oid{t_int8, t_text, t_int2, t_bytea},
+	}
+	cn.types = map[oid]registeredType{r.oid: r}
+
+	c := cn.decode([]byte(`(1,Ann,,"\\x0102")`), r.oid).(Composite)
+	want := Composite{Names: r.attNames, Fields: []interface{}{int64(1), []byte("Ann"), nil, []byte{1, 2}}}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("expected %v, got %v", want, c)
+	}
+
+	type person struct {
+		Photo []byte
+		Name  string `pq:"full_name"`
+		Age   *int
+	}
+	var p person
+	if err := (CompositeStruct{&p}).Scan(c); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Ann" || p.Age != nil || len(p.Photo) != 2 {
+		t.Errorf("unexpected %+v", p)
+	}
+
+	if b := string(cn.encode(CompositeStruct{p}, r.oid)); b != `(,"Ann",,"\\x0102")` {
+		t.Errorf("unexpected %s", b)
+	}
+
+	// A nil pointer is sent as NULL.
+	for _, v := range []interface{}{(*person)(nil), &p} {
+		nv := driver.NamedValue{Value: CompositeStruct{v}}
+		if err := cn.CheckNamedValue(&nv); err != nil {
+			t.Fatal(err)
+		}
+		if null := nv.Value == nil; null != (v == (*person)(nil)) {
+			t.Errorf("%#v: unexpected %#v", v, nv.Value)
+		}
+	}
+
+	err := func() (err error) {
+		defer errRecover(&err)
+		cn.decode([]byte(`(1,2)`), r.oid)
+		return nil
+	}()
+	if err == nil || !strings.Contains(err.Error(), "person") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCompositeRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	defer clearTypeRegistry()
+
+	var c Composite
+	if err := db.QueryRow("SELECT ROW(1, 'a b', NULL)").Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Fields) != 3 || string(c.Fields[1].([]byte)) != "a b" || c.Fields[2] != nil {
+		t.Errorf("unexpected %v", c)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("CREATE TYPE pq_address AS (street text, number int4, since date)"); err != nil {
+		t.Fatal(err)
+	}
+
+	type address struct {
+		Number int `pq:"number"`
+		Street string
+	}
+	// Unregistered, fields are matched in order.
+	var a struct {
+		Street string
+		Number int
+		Since  *time.Time
+	}
+	if err := tx.QueryRow("SELECT ('Main St', 12, NULL)::pq_address").Scan(CompositeStruct{&a}); err != nil {
+		t.Fatal(err)
+	}
+	if a.Street != "Main St" || a.Number != 12 || a.Since != nil {
+		t.Errorf("unexpected %+v", a)
+	}
+
+	RegisterComposite("pq_address")
+	if err := tx.QueryRow("SELECT $1::pq_address", CompositeStruct{address{Number: 5, Street: "High St"}}).Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+	want := Composite{Names: []string{"street", "number", "since"}, Fields: []interface{}{[]byte("High St"), int64(5), nil}}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("expected %v, got %v", want, c)
+	}
+}
@@ -2,6 +2,7 @@ package pq
 
 import (
 	"bufio"
+	"context"
 	"crypto/md5"
 	"crypto/tls"
 	"database/sql"
@@ -14,13 +15,18 @@ import (
 	"os"
 	"os/user"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	ErrSSLNotSupported = errors.New("pq: SSL is not enabled on the server")
 	ErrNotSupported    = errors.New("pq: invalid command")
+
+	ErrInTransaction       = errors.New("pq: a transaction is already in progress")
+	ErrInFailedTransaction = errors.New("pq: transaction was aborted by an earlier error; COMMIT rolled it back")
 )
 
 type drv struct{}
@@ -37,6 +43,64 @@ type conn struct {
 	c     net.Conn
 	buf   *bufio.Reader
 	namei int
+
+	// txnStatus is the transaction status reported by the last
+	// ReadyForQuery message.
+	txnStatus transactionStatus
+
+	// parameterStatus holds the run-time parameters reported by the
+	// server in ParameterStatus messages.
+	parameterStatus map[string]string
+
+	// returningID is set by last_insert_id=returning; see
+	// result.LastInsertId.
+	returningID bool
+
+	// timestampZone is the timestamp_zone option, and sessionZone
+	// and sessionLoc cache the location of the session TimeZone
+	// for timestamp_zone=session.
+	timestampZone string
+	sessionZone   string
+	sessionLoc    *time.Location
+
+	// types maps the OIDs of the types registered with RegisterType
+	// to their registrations, as resolved for the registry as it was
+	// at generation typesGen. resolvingTypes is set while they are
+	// looked up.
+	types          map[oid]registeredType
+	typesGen       int
+	resolvingTypes bool
+
+	// opts are the options the connection was opened with, and
+	// processID and secretKey identify its backend; all three are
+	// needed to send a cancel request.
+	opts      Values
+	processID int
+	secretKey int
+}
+
+// ServerInfo is implemented by pq's driver connections and exposes the
+// run-time parameters reported by the server, such as server_version,
+// server_encoding, client_encoding, DateStyle, TimeZone,
+// integer_datetimes, standard_conforming_strings and in_hot_standby.
+// Reach it through (*sql.Conn).Raw:
+//
+//	err := c.Raw(func(dc interface{}) error {
+//		v := dc.(pq.ServerInfo).ServerVersion()
+//		// ...
+//	})
+type ServerInfo interface {
+	// ParameterStatus returns the last reported value of the named
+	// parameter, or "" if the server has not reported it.
+	ParameterStatus(name string) string
+
+	// ServerParameters returns a copy of all reported parameters.
+	ServerParameters() map[string]string
+
+	// ServerVersion returns the server version in the form used by
+	// libpq's PQserverVersion, e.g. 90603 for 9.6.3 and 140005 for
+	// 14.5, or 0 if it is unknown.
+	ServerVersion() int
 }
 
 func Open(name string) (_ driver.Conn, err error) {
@@ -69,18 +133,137 @@ func Open(name string) (_ driver.Conn, err error) {
 
 	parseOpts(name, o)
 
-	c, err := net.Dial(network(o))
+	// connect_timeout bounds the whole connection attempt, not just
+	// the dial: SSL negotiation and authentication count against the
+	// same deadline.
+	var deadline time.Time
+	if d := connectTimeout(o); d > 0 {
+		deadline = time.Now().Add(d)
+	}
+
+	var returningID bool
+	switch v := o.Get("last_insert_id"); v {
+	case "", "oid":
+	case "returning":
+		returningID = true
+	default:
+		errorf("invalid last_insert_id: %q", v)
+	}
+
+	switch v := o.Get("timestamp_zone"); v {
+	case "", "utc", "local", "session":
+	default:
+		errorf("invalid timestamp_zone: %q", v)
+	}
+
+	// Built before dialing, so that invalid settings fail fast.
+	ps := startupParams(o)
+
+	dl := dialer(o)
+	dl.Deadline = deadline
+	c, err := dl.Dial(network(o))
 	if err != nil {
 		return nil, err
 	}
 
-	cn := &conn{c: c}
+	cn := &conn{c: c, opts: o, returningID: returningID, timestampZone: o.Get("timestamp_zone")}
+
+	// Past this point a failure must close the connection. An expired
+	// connect_timeout is returned as it is, not as driver.ErrBadConn,
+	// which database/sql would retry.
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+		cn.c.Close()
+		if ne, ok := e.(net.Error); ok && ne.Timeout() {
+			err = ne
+			return
+		}
+		panic(e)
+	}()
+
+	if !deadline.IsZero() {
+		cn.c.SetDeadline(deadline)
+	}
 	cn.ssl(o)
 	cn.buf = bufio.NewReader(cn.c)
-	cn.startup(o)
+	cn.startup(o, ps)
+	if !deadline.IsZero() {
+		cn.c.SetDeadline(time.Time{})
+	}
 	return cn, nil
 }
 
+// connectTimeout returns the connect_timeout option as a duration.
+// Zero, negative or absent values mean wait indefinitely, as in libpq.
+func connectTimeout(o Values) time.Duration {
+	s := o.Get("connect_timeout")
+	if s == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		errorf("invalid connect_timeout: %q", s)
+	}
+
+	if n <= 0 {
+		return 0
+	}
+
+	return time.Duration(n) * time.Second
+}
+
+// dialer builds a net.Dialer honouring the keepalives,
+// keepalives_idle, keepalives_interval and keepalives_count options.
+// Settings that are not given are left at the operating system's
+// defaults.
+func dialer(o Values) *net.Dialer {
+	d := &net.Dialer{}
+
+	switch v := o.Get("keepalives"); v {
+	case "", "1":
+		// enabled
+	case "0":
+		d.KeepAlive = -1
+		return d
+	default:
+		errorf("invalid keepalives: %q", v)
+	}
+
+	d.KeepAliveConfig = net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     keepaliveOpt(o, "keepalives_idle") * time.Second,
+		Interval: keepaliveOpt(o, "keepalives_interval") * time.Second,
+		Count:    int(keepaliveOpt(o, "keepalives_count")),
+	}
+
+	return d
+}
+
+// keepaliveOpt parses a non-negative integer keepalive option. As in
+// libpq, zero or absent means the system default, which is spelled -1
+// for net.KeepAliveConfig.
+func keepaliveOpt(o Values, k string) time.Duration {
+	s := o.Get(k)
+	if s == "" {
+		return -1
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		errorf("invalid %s: %q", k, s)
+	}
+
+	if n == 0 {
+		return -1
+	}
+
+	return time.Duration(n)
+}
+
 func network(o Values) (string, string) {
 	host := o.Get("host")
 
@@ -103,39 +286,359 @@ func (vs Values) Get(k string) (v string) {
 	return
 }
 
+// conninfoSpace holds the characters that separate conninfo options.
+const conninfoSpace = " \t\n\r\f\v"
+
+// parseOpts parses a conninfo string of key=value pairs separated by
+// whitespace. As in libpq, a value may be single-quoted to hold spaces,
+// and a backslash includes the following character literally, within
+// quotes or not.
 func parseOpts(name string, o Values) {
-	if len(name) == 0 {
-		return
+	s := name
+	for {
+		s = strings.TrimLeft(s, conninfoSpace)
+		if s == "" {
+			return
+		}
+
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			errorf("invalid option: %q", s)
+		}
+		k := strings.TrimRight(s[:i], conninfoSpace)
+		if k == "" || strings.ContainsAny(k, conninfoSpace) {
+			errorf("invalid option: %q", s)
+		}
+		s = strings.TrimLeft(s[i+1:], conninfoSpace)
+
+		var v []byte
+		quoted := strings.HasPrefix(s, "'")
+		if quoted {
+			s = s[1:]
+		}
+		for {
+			if s == "" {
+				if quoted {
+					errorf("unterminated quoted value for option %q", k)
+				}
+				break
+			}
+			c := s[0]
+			if quoted && c == '\'' {
+				s = s[1:]
+				break
+			}
+			if !quoted && strings.IndexByte(conninfoSpace, c) >= 0 {
+				break
+			}
+			if c == '\\' && len(s) > 1 {
+				s = s[1:]
+				c = s[0]
+			}
+			v = append(v, c)
+			s = s[1:]
+		}
+		o.Set(k, string(v))
+	}
+}
+
+// driverOpts are the connection options consumed by pq itself. Every
+// other option is a run-time parameter and is forwarded to the server
+// in the startup message.
+var driverOpts = map[string]bool{
+	"host":                      true,
+	"hostaddr":                  true,
+	"port":                      true,
+	"user":                      true,
+	"password":                  true,
+	"dbname":                    true,
+	"sslmode":                   true,
+	"requiressl":                true,
+	"sslcert":                   true,
+	"sslkey":                    true,
+	"sslrootcert":               true,
+	"sslcrl":                    true,
+	"requirepeer":               true,
+	"krbsrvname":                true,
+	"gsslib":                    true,
+	"connect_timeout":           true,
+	"keepalives":                true,
+	"keepalives_idle":           true,
+	"keepalives_interval":       true,
+	"keepalives_count":          true,
+	"options":                   true,
+	"fallback_application_name": true,
+	"last_insert_id":            true,
+	"timestamp_zone":            true,
+}
+
+// startupParams collects the run-time parameters to send in the
+// startup message. Settings given with -c or -- in the "options"
+// option are sent as parameters of their own; anything else in
+// "options" is passed through for the server to interpret.
+func startupParams(o Values) map[string]string {
+	ps := make(map[string]string)
+
+	if v := o.Get("options"); v != "" {
+		var rest []string
+		args := splitOptions(v)
+		for i := 0; i < len(args); i++ {
+			a := args[i]
+			switch {
+			case a == "-c" && i+1 < len(args):
+				i++
+				a = args[i]
+			case strings.HasPrefix(a, "-c"):
+				a = a[2:]
+			case strings.HasPrefix(a, "--"):
+				a = a[2:]
+			default:
+				rest = append(rest, args[i])
+				continue
+			}
+
+			kv := strings.SplitN(a, "=", 2)
+			if len(kv) < 2 {
+				errorf("invalid setting in options: %q", a)
+			}
+			ps[strings.Replace(kv[0], "-", "_", -1)] = kv[1]
+		}
+
+		if len(rest) > 0 {
+			ps["options"] = strings.Join(rest, " ")
+		}
+	}
+
+	for k, v := range o {
+		if !driverOpts[k] {
+			ps[k] = v
+		}
+	}
+
+	if ps["application_name"] == "" {
+		if v := o.Get("fallback_application_name"); v != "" {
+			ps["application_name"] = v
+		}
 	}
 
-	ps := strings.Split(name, " ")
-	for _, p := range ps {
-		kv := strings.Split(p, "=")
-		if len(kv) < 2 {
-			errorf("invalid option: %q", p)
+	// Dates and times are only decoded in the ISO style, so ask for
+	// it unless a DateStyle is given; one that only sets the field
+	// order has ISO added, and one with another style is refused.
+	dateStyle := false
+	for k, v := range ps {
+		if strings.EqualFold(k, "datestyle") {
+			dateStyle = true
+			ps[k] = isoDateStyle(v)
 		}
-		o.Set(kv[0], kv[1])
 	}
+	if !dateStyle {
+		ps["datestyle"] = "ISO, MDY"
+	}
+
+	return ps
+}
+
+// isoDateStyle returns the DateStyle setting s with the ISO output
+// style, adding it if s only gives a field order.
+func isoDateStyle(s string) string {
+	iso := false
+	for _, f := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case "iso":
+			iso = true
+		case "sql", "postgres", "german":
+			errorf("unsupported datestyle %q: pq requires the ISO output style", s)
+		}
+	}
+	if !iso {
+		return "ISO, " + s
+	}
+	return s
+}
+
+// splitOptions splits the "options" option on whitespace. As in the
+// server, a backslash includes the following character literally,
+// allowing spaces in values.
+func splitOptions(s string) (args []string) {
+	var cur []byte
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			cur = append(cur, s[i])
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, string(cur))
+				cur = cur[:0]
+				inArg = false
+			}
+		default:
+			cur = append(cur, c)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, string(cur))
+	}
+
+	return args
+}
+
+type transactionStatus byte
+
+const (
+	txnStatusIdle                = transactionStatus('I')
+	txnStatusIdleInTransaction   = transactionStatus('T')
+	txnStatusInFailedTransaction = transactionStatus('E')
+)
+
+func (s transactionStatus) String() string {
+	switch s {
+	case txnStatusIdle:
+		return "idle"
+	case txnStatusIdleInTransaction:
+		return "idle in transaction"
+	case txnStatusInFailedTransaction:
+		return "in a failed transaction"
+	}
+	return fmt.Sprintf("unknown transactionStatus %q", byte(s))
+}
+
+func (cn *conn) processReadyForQuery(r *readBuf) {
+	cn.txnStatus = transactionStatus(r.byte())
 }
 
 func (cn *conn) Begin() (driver.Tx, error) {
-	_, err := cn.Exec("BEGIN", nil)
+	return cn.begin("BEGIN")
+}
+
+// BeginTx implements driver.ConnBeginTx, mapping the isolation level
+// and read-only flag of sql.TxOptions onto the BEGIN statement. Use
+// Deferrable to request a DEFERRABLE transaction.
+func (cn *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	q, err := beginQuery(opts, isDeferrable(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return cn.begin(q)
+}
+
+func (cn *conn) begin(q string) (driver.Tx, error) {
+	if cn.txnStatus != txnStatusIdle {
+		return nil, ErrInTransaction
+	}
+
+	_, err := cn.Exec(q, nil)
 	if err != nil {
 		return nil, err
 	}
+
+	if cn.txnStatus != txnStatusIdleInTransaction {
+		return nil, fmt.Errorf("pq: unexpected transaction status %v after BEGIN", cn.txnStatus)
+	}
 	return cn, err
 }
 
+// beginQuery builds the BEGIN statement for the given options.
+func beginQuery(opts driver.TxOptions, deferrable bool) (string, error) {
+	q := "BEGIN"
+
+	switch level := sql.IsolationLevel(opts.Isolation); level {
+	case sql.LevelDefault:
+		// server default, usually read committed
+	case sql.LevelReadUncommitted:
+		q += " ISOLATION LEVEL READ UNCOMMITTED"
+	case sql.LevelReadCommitted:
+		q += " ISOLATION LEVEL READ COMMITTED"
+	case sql.LevelRepeatableRead:
+		q += " ISOLATION LEVEL REPEATABLE READ"
+	case sql.LevelSerializable:
+		q += " ISOLATION LEVEL SERIALIZABLE"
+	default:
+		return "", fmt.Errorf("pq: isolation level not supported by PostgreSQL: %v", level)
+	}
+
+	if opts.ReadOnly {
+		q += " READ ONLY"
+	}
+
+	if deferrable {
+		if sql.IsolationLevel(opts.Isolation) != sql.LevelSerializable || !opts.ReadOnly {
+			return "", errors.New("pq: DEFERRABLE requires a serializable, read-only transaction")
+		}
+		q += " DEFERRABLE"
+	}
+
+	return q, nil
+}
+
+type deferrableKey struct{}
+
+// Deferrable returns a context that makes BeginTx start a DEFERRABLE
+// transaction. Such a transaction must also be serializable and read
+// only; it may block when it starts, but then runs without the risk
+// of serialization failures, which suits long-running reports:
+//
+//	tx, err := db.BeginTx(pq.Deferrable(ctx), &sql.TxOptions{
+//		Isolation: sql.LevelSerializable,
+//		ReadOnly:  true,
+//	})
+func Deferrable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deferrableKey{}, true)
+}
+
+func isDeferrable(ctx context.Context) bool {
+	d, _ := ctx.Value(deferrableKey{}).(bool)
+	return d
+}
+
+// Commit commits the transaction. If the transaction had already
+// failed the server rolls it back instead, and ErrInFailedTransaction
+// is returned. If the transaction has already ended, for example by
+// PREPARE TRANSACTION, there is nothing to do.
 func (cn *conn) Commit() error {
+	if cn.txnStatus == txnStatusIdle {
+		return nil
+	}
+
+	failed := cn.txnStatus == txnStatusInFailedTransaction
+
 	_, err := cn.Exec("COMMIT", nil)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		return ErrInFailedTransaction
+	}
+	return nil
 }
 
 func (cn *conn) Rollback() error {
+	if cn.txnStatus == txnStatusIdle {
+		return nil
+	}
+
 	_, err := cn.Exec("ROLLBACK", nil)
 	return err
 }
 
+// IsValid implements driver.Validator. database/sql discards
+// connections that are returned to the pool while a transaction is
+// still open on them, rather than handing that transaction to the next
+// user.
+func (cn *conn) IsValid() bool {
+	return cn.txnStatus == txnStatusIdle
+}
+
 func (cn *conn) gname() string {
 	cn.namei++
 	return strconv.FormatInt(int64(cn.namei), 10)
@@ -148,17 +651,30 @@ func (cn *conn) simpleQuery(q string) (res driver.Result, err error) {
 	b.string(q)
 	cn.send(b)
 
+	var ncols int
+	var rid returnedID
 	for {
 		t, r := cn.recv1()
 		switch t {
 		case 'C':
-			res = parseComplete(r.string())
+			res = rid.complete(r.string())
+			ncols = 0
 		case 'Z':
+			cn.processReadyForQuery(r)
 			// done
 			return
 		case 'E':
 			err = parseError(r)
-		case 'T', 'N', 'S':
+		case 'S':
+			cn.processParameterStatus(r)
+		case 'T':
+			ncols = r.int16()
+		case 'D':
+			if !cn.returningID || ncols != 1 {
+				errorf("unknown response for simple query: %q", t)
+			}
+			rid.row(r)
+		case 'N':
 			// ignore
 		default:
 			errorf("unknown response for simple query: %q", t)
@@ -167,8 +683,64 @@ func (cn *conn) simpleQuery(q string) (res driver.Result, err error) {
 	panic("not reached")
 }
 
+// simpleQueryRows runs q, which may hold several statements, with the
+// simple query protocol. The rows of each statement that returns any
+// form a result set of their own.
+func (cn *conn) simpleQueryRows(q string) (_ *rows, err error) {
+	defer errRecover(&err)
+	cn.resolveTypes()
+
+	b := newWriteBuf('Q')
+	b.string(q)
+	cn.send(b)
+
+	// Read up to the first result set. As with prepared queries,
+	// errors from running the query are reported by Next rather than
+	// here, even those that come before it.
+	rs := &rows{st: &stmt{cn: cn, query: q}, simple: true}
+	rs.err = rs.readAhead()
+
+	if rs.next != nil {
+		rs.st, rs.next = rs.next, nil
+	}
+	return rs, nil
+}
+
+// fieldDesc describes a result column, as sent in RowDescription.
+type fieldDesc struct {
+	// table and column identify the table column the result column
+	// comes from, if any; otherwise both are zero.
+	table  oid
+	column int
+
+	typ    oid
+	len    int // pg_type.typlen; negative for variable-length types
+	mod    int // type modifier, or -1
+	format int // 0 for text, 1 for binary
+}
+
+func parseRowDescription(r *readBuf) (cols []string, typs []oid, fields []fieldDesc) {
+	n := r.int16()
+	cols = make([]string, n)
+	typs = make([]oid, n)
+	fields = make([]fieldDesc, n)
+	for i := range cols {
+		cols[i] = r.string()
+		f := &fields[i]
+		f.table = r.oid()
+		f.column = int(int16(r.int16()))
+		f.typ = r.oid()
+		f.len = int(int16(r.int16()))
+		f.mod = r.int32()
+		f.format = r.int16()
+		typs[i] = f.typ
+	}
+	return cols, typs, fields
+}
+
 func (cn *conn) prepareTo(q, stmtName string) (_ driver.Stmt, err error) {
 	defer errRecover(&err)
+	cn.resolveTypes()
 
 	st := &stmt{cn: cn, name: stmtName, query: q}
 
@@ -189,6 +761,8 @@ func (cn *conn) prepareTo(q, stmtName string) (_ driver.Stmt, err error) {
 		t, r := cn.recv1()
 		switch t {
 		case '1', '2', 'N':
+		case 'S':
+			cn.processParameterStatus(r)
 		case 't':
 			st.nparams = int(r.int16())
 			st.paramTyps = make([]oid, st.nparams, st.nparams)
@@ -197,18 +771,11 @@ func (cn *conn) prepareTo(q, stmtName string) (_ driver.Stmt, err error) {
 				st.paramTyps[i] = r.oid()
 			}
 		case 'T':
-			n := r.int16()
-			st.cols = make([]string, n)
-			st.rowTyps = make([]oid, n)
-			for i := range st.cols {
-				st.cols[i] = r.string()
-				r.next(6)
-				st.rowTyps[i] = r.oid()
-				r.next(8)
-			}
+			st.cols, st.rowTyps, st.fields = parseRowDescription(r)
 		case 'n':
 			// no data
 		case 'Z':
+			cn.processReadyForQuery(r)
 			return st, err
 		case 'E':
 			err = parseError(r)
@@ -305,6 +872,63 @@ func (cn *conn) recv1() (byte, *readBuf) {
 	return x[0], (*readBuf)(&y)
 }
 
+// cancel asks the server to cancel the query running on cn's backend.
+// The request is sent over a new connection, so it is safe to call
+// while cn is waiting for a response. Whether or not the server acts on
+// it, cn itself will receive the outcome of the query as usual.
+func (cn *conn) cancel() (err error) {
+	defer errRecover(&err)
+
+	dl := dialer(cn.opts)
+	dl.Timeout = connectTimeout(cn.opts)
+	c, err := dl.Dial(network(cn.opts))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	can := &conn{c: c}
+	w := newWriteBuf(0)
+	w.int32(80877102)
+	w.int32(cn.processID)
+	w.int32(cn.secretKey)
+	can.send(w)
+
+	// The server closes the connection without replying once it has
+	// read the request.
+	_, err = c.Read(make([]byte, 1))
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// watchCancel sends a cancel request for cn's current query if ctx is
+// done before the returned function is called. That function must be
+// called once the query is complete; it waits for any cancel request in
+// flight, so that it cannot hit a later query.
+func (cn *conn) watchCancel(ctx context.Context) (finish func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			cn.cancel()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
 func (cn *conn) ssl(o Values) {
 	tlsConf := tls.Config{}
 	switch mode := o.Get("sslmode"); mode {
@@ -335,23 +959,40 @@ func (cn *conn) ssl(o Values) {
 	cn.c = tls.Client(cn.c, &tlsConf)
 }
 
-func (cn *conn) startup(o Values) {
+func (cn *conn) startup(o Values, ps map[string]string) {
 	w := newWriteBuf(0)
 	w.int32(196608)
 	w.string("user")
 	w.string(o.Get("user"))
 	w.string("database")
 	w.string(o.Get("dbname"))
+
+	// Sorted only so the startup message is deterministic.
+	ks := make([]string, 0, len(ps))
+	for k := range ps {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	for _, k := range ks {
+		w.string(k)
+		w.string(ps[k])
+	}
+
 	w.string("")
 	cn.send(w)
 
 	for {
 		t, r := cn.recv()
 		switch t {
-		case 'K', 'S':
+		case 'K':
+			cn.processID = r.int32()
+			cn.secretKey = r.int32()
+		case 'S':
+			cn.processParameterStatus(r)
 		case 'R':
 			cn.auth(r, o)
 		case 'Z':
+			cn.processReadyForQuery(r)
 			return
 		default:
 			errorf("unknown response for startup: %q", t)
@@ -395,6 +1036,218 @@ func (cn *conn) auth(r *readBuf, o Values) {
 	}
 }
 
+func (cn *conn) processParameterStatus(r *readBuf) {
+	if cn.parameterStatus == nil {
+		cn.parameterStatus = make(map[string]string)
+	}
+	k := r.string()
+	cn.parameterStatus[k] = r.string()
+}
+
+// decode decodes a column value of type typ, with the decoder
+// registered for it if there is one. Date and time values are refused
+// unless the session DateStyle is ISO, since a SET DateStyle after
+// startup may have changed it, and timestamp values are placed in the
+// location chosen by the timestamp_zone option.
+func (cn *conn) decode(s []byte, typ oid) interface{} {
+	if r, ok := cn.types[typ]; ok && r.composite {
+		return cn.decodeComposite(s, r)
+	} else if ok && r.dec != nil {
+		v, err := r.dec(s)
+		if err != nil {
+			errorf("decode %s: %s", r, err)
+		}
+		return v
+	}
+
+	switch typ {
+	case t_timestamptz, t_timestamp, t_date, t_time, t_timetz:
+		if ds := cn.parameterStatus["DateStyle"]; ds != "" && !strings.HasPrefix(ds, "ISO") {
+			errorf("unsupported DateStyle %q: pq requires the ISO output style", ds)
+		}
+	}
+
+	v := decode(s, typ)
+	if t, ok := v.(time.Time); ok && typ == t_timestamp {
+		if _, inf := decodeInfinity(s); !inf {
+			if loc := cn.timestampLocation(); loc != nil {
+				v = wallClockIn(t, loc)
+			}
+		}
+	}
+	return v
+}
+
+// convert gives a parameter of type typ the default conversion if
+// CheckNamedValue passed it through for a registered encoder, but
+// neither that encoder nor encode knows its type. The result is nil
+// for NULL, as for a typed nil pointer.
+func (cn *conn) convert(x interface{}, typ oid) interface{} {
+	if r, ok := cn.types[typ]; ok && (r.composite || r.enc != nil) {
+		return x
+	}
+	if x == nil || encodes(x) {
+		return x
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(x)
+	if err != nil {
+		errorf("encode: %s", err)
+	}
+	return v
+}
+
+// encode encodes a parameter of type typ, which convert has given.
+// The encoder registered for typ is used if there is one.
+//
+// With the timestamp_zone option, a time.Time sent as a timestamp is
+// first converted to the location timestamps are read in, since the
+// server drops the offset.
+func (cn *conn) encode(x interface{}, typ oid) []byte {
+	if r, ok := cn.types[typ]; ok && r.composite {
+		return encodeComposite(x, r)
+	} else if ok && r.enc != nil {
+		b, err := r.enc(x)
+		if err != nil {
+			errorf("encode %s: %s", r, err)
+		}
+		return b
+	}
+
+	if t, ok := x.(time.Time); ok && typ == t_timestamp {
+		if loc := cn.timestampLocation(); loc != nil {
+			x = t.In(loc)
+		}
+	}
+	return encode(x, typ)
+}
+
+// timestampLocation returns the location of timestamp values under
+// the timestamp_zone option, or nil if it is not set, in which case
+// they are read as UTC and times are sent as they are.
+func (cn *conn) timestampLocation() *time.Location {
+	switch cn.timestampZone {
+	case "utc":
+		return time.UTC
+	case "local":
+		return time.Local
+	case "session":
+		tz := cn.parameterStatus["TimeZone"]
+		if cn.sessionLoc == nil || tz != cn.sessionZone {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				var ok bool
+				if loc, ok = posixZone(tz); !ok {
+					errorf("cannot load session TimeZone %q: %s", tz, err)
+				}
+			}
+			cn.sessionZone, cn.sessionLoc = tz, loc
+		}
+		return cn.sessionLoc
+	}
+	return nil
+}
+
+// wallClockIn returns the time in loc with the same wall clock as t.
+func wallClockIn(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// posixZone returns a fixed zone for a POSIX time zone without daylight
+// saving time, such as "<+03>-03" or "JST-9", which the server reports
+// for zones set as an offset. POSIX offsets are west of Greenwich, the
+// opposite of ISO 8601.
+func posixZone(tz string) (*time.Location, bool) {
+	var name string
+	if strings.HasPrefix(tz, "<") {
+		i := strings.IndexByte(tz, '>')
+		if i < 0 {
+			return nil, false
+		}
+		name, tz = tz[1:i], tz[i+1:]
+	} else {
+		i := strings.IndexAny(tz, "+-0123456789")
+		if i < 3 {
+			return nil, false
+		}
+		name, tz = tz[:i], tz[i:]
+	}
+
+	sign := -1
+	if tz != "" && (tz[0] == '+' || tz[0] == '-') {
+		if tz[0] == '-' {
+			sign = 1
+		}
+		tz = tz[1:]
+	}
+
+	var secs int
+	for i, f := range strings.SplitN(tz, ":", 3) {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 || f[0] == '+' || i > 0 && n > 59 || i == 0 && n > 24 {
+			return nil, false
+		}
+		secs = secs*60 + n
+	}
+	for i := strings.Count(tz, ":"); i < 2; i++ {
+		secs *= 60
+	}
+	return time.FixedZone(name, sign*secs), true
+}
+
+func (cn *conn) ParameterStatus(name string) string {
+	return cn.parameterStatus[name]
+}
+
+func (cn *conn) ServerParameters() map[string]string {
+	ps := make(map[string]string, len(cn.parameterStatus))
+	for k, v := range cn.parameterStatus {
+		ps[k] = v
+	}
+	return ps
+}
+
+func (cn *conn) ServerVersion() int {
+	return parseServerVersion(cn.ParameterStatus("server_version"))
+}
+
+// parseServerVersion converts a server_version string such as "9.6.3",
+// "14.5 (Debian 14.5-1)" or "16beta2" to libpq's integer form. Since
+// 10 the version has only two parts and the minor number is not scaled.
+func parseServerVersion(s string) int {
+	var parts []int
+	n, digits := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			n = n*10 + int(s[i]-'0')
+			digits++
+			continue
+		}
+		if digits == 0 {
+			break
+		}
+		parts = append(parts, n)
+		n, digits = 0, 0
+		if i == len(s) || s[i] != '.' {
+			break
+		}
+	}
+
+	switch {
+	case len(parts) == 0:
+		return 0
+	case parts[0] >= 10:
+		if len(parts) < 2 {
+			parts = append(parts, 0)
+		}
+		return parts[0]*10000 + parts[1]
+	default:
+		for len(parts) < 3 {
+			parts = append(parts, 0)
+		}
+		return parts[0]*10000 + parts[1]*100 + parts[2]
+	}
+}
+
 type stmt struct {
 	cn        *conn
 	name      string
@@ -402,6 +1255,7 @@ type stmt struct {
 	cols      []string
 	nparams   int
 	rowTyps   []oid
+	fields    []fieldDesc
 	paramTyps []oid
 	closed    bool
 }
@@ -426,10 +1280,11 @@ func (st *stmt) Close() (err error) {
 	}
 	st.closed = true
 
-	t, _ = st.cn.recv()
+	t, r := st.cn.recv()
 	if t != 'Z' {
 		errorf("expected ready for query, but got: %q", t)
 	}
+	st.cn.processReadyForQuery(r)
 
 	return nil
 }
@@ -448,19 +1303,26 @@ func (st *stmt) Exec(v []driver.Value) (res driver.Result, err error) {
 	}
 	st.exec(v)
 
+	var rid returnedID
 	for {
 		t, r := st.cn.recv1()
 		switch t {
 		case 'E':
 			err = parseError(r)
 		case 'C':
-			res = parseComplete(r.string())
+			res = rid.complete(r.string())
 		case 'Z':
+			st.cn.processReadyForQuery(r)
 			// done
 			return
 		case 'D':
-			errorf("unexpected data row returned in Exec; check your query")
-		case 'S', 'N':
+			if !st.cn.returningID || len(st.cols) != 1 {
+				errorf("unexpected data row returned in Exec; check your query")
+			}
+			rid.row(r)
+		case 'S':
+			st.cn.processParameterStatus(r)
+		case 'N':
 			// Ignore
 		default:
 			errorf("unknown exec response: %q", t)
@@ -477,10 +1339,11 @@ func (st *stmt) exec(v []driver.Value) {
 	w.int16(0)
 	w.int16(len(v))
 	for i, x := range v {
+		x = st.cn.convert(x, st.paramTyps[i])
 		if x == nil {
 			w.int32(-1)
 		} else {
-			b := encode(x, st.paramTyps[i])
+			b := st.cn.encode(x, st.paramTyps[i])
 			w.int32(len(b))
 			w.bytes(b)
 		}
@@ -507,10 +1370,13 @@ func (st *stmt) exec(v []driver.Value) {
 			}
 			return
 		case 'Z':
+			st.cn.processReadyForQuery(r)
 			if err != nil {
 				panic(err)
 			}
 			return
+		case 'S':
+			st.cn.processParameterStatus(r)
 		case 'N':
 			// ignore
 		default:
@@ -523,33 +1389,197 @@ func (st *stmt) NumInput() int {
 	return st.nparams
 }
 
-type result int64
+// CommandTag is the tag of the CommandComplete message the server
+// sends at the end of each statement, such as "INSERT 0 1", "UPDATE 0",
+// "SELECT 5", "MERGE 2" or "CREATE TABLE". Use WithCommandTag to
+// obtain it through database/sql, or CommandTagger on the driver's
+// results and rows.
+type CommandTag string
+
+// CommandTagger is implemented by the driver.Result and driver.Rows
+// that pq returns, which (*sql.Conn).Raw gives access to. The tag of
+// rows is that of their current result set, once it has been read to
+// the end; until then it is "".
+type CommandTagger interface {
+	CommandTag() CommandTag
+}
+
+// Command returns the name of the command, such as "INSERT", "FETCH"
+// or "CREATE TABLE".
+func (t CommandTag) Command() string {
+	parts := strings.Split(string(t), " ")
+	if _, ok := t.count(); ok {
+		parts = parts[:len(parts)-1]
+		if parts[0] == "INSERT" {
+			parts = parts[:1]
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// RowsAffected returns the number of rows the command processed, or 0
+// if its tag carries no count.
+func (t CommandTag) RowsAffected() int64 {
+	n, _ := t.count()
+	return n
+}
+
+func (t CommandTag) count() (int64, bool) {
+	i := strings.LastIndex(string(t), " ")
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(t[i+1:]), 10, 64)
+	return n, err == nil
+}
+
+type result struct {
+	tag          CommandTag
+	rowsAffected int64
+
+	// insertID is the OID reported for a single-row INSERT into a
+	// table with OIDs, or the value of the single-column RETURNING
+	// clause of an INSERT when last_insert_id=returning is set.
+	insertID      int64
+	insertIDValid bool
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
 
-func (i result) RowsAffected() (int64, error) {
-	return int64(i), nil
+// CommandTag implements CommandTagger.
+func (r result) CommandTag() CommandTag {
+	return r.tag
 }
 
-func (i result) LastInsertId() (int64, error) {
-	return 0, ErrNotSupported
+// LastInsertId returns the OID of the inserted row or, if the
+// connection was opened with last_insert_id=returning, the integer
+// returned by an INSERT ... RETURNING clause with a single column.
+// Otherwise it returns ErrNotSupported.
+func (r result) LastInsertId() (int64, error) {
+	if !r.insertIDValid {
+		return 0, ErrNotSupported
+	}
+	return r.insertID, nil
 }
 
-func parseComplete(s string) driver.Result {
+func parseComplete(s string) result {
+	tag := CommandTag(s)
+	res := result{tag: tag, rowsAffected: tag.RowsAffected()}
+
 	parts := strings.Split(s, " ")
-	n, _ := strconv.ParseInt(parts[len(parts)-1], 10, 64)
-	return result(n)
+	// "INSERT oid rows"; the OID is only non-zero for a single row
+	// inserted into a table with OIDs.
+	if len(parts) == 3 && parts[0] == "INSERT" {
+		id, err := strconv.ParseInt(parts[1], 10, 64)
+		if err == nil && id != 0 {
+			res.insertID, res.insertIDValid = id, true
+		}
+	}
+
+	return res
+}
+
+// returnedID collects the value of the single-column RETURNING clause
+// of an INSERT run with Exec, for LastInsertId.
+type returnedID struct {
+	id    int64
+	valid bool
+}
+
+// row reads a DataRow. Values that are not integers, such as UUIDs,
+// cannot serve as LastInsertId and are ignored.
+func (ri *returnedID) row(r *readBuf) {
+	ri.valid = false
+	if r.int16() != 1 {
+		return
+	}
+
+	l := r.int32()
+	if l < 0 {
+		return
+	}
+
+	id, err := strconv.ParseInt(string(r.next(l)), 10, 64)
+	if err == nil {
+		ri.id, ri.valid = id, true
+	}
+}
+
+func (ri *returnedID) complete(tag string) result {
+	res := parseComplete(tag)
+	if ri.valid && strings.HasPrefix(tag, "INSERT ") {
+		res.insertID, res.insertIDValid = ri.id, true
+	}
+	*ri = returnedID{}
+	return res
 }
 
 type rows struct {
 	st   *stmt
 	done bool
+
+	// tag, if not nil, receives the command tag; see WithCommandTag.
+	// lastTag is the tag of the current result set; see CommandTag.
+	tag     *CommandTag
+	lastTag CommandTag
+
+	// Rows of a simple query may come in several result sets. eos is
+	// set at the end of each, and next describes the following one
+	// once it has been read.
+	simple bool
+	eos    bool
+	next   *stmt
+
+	// err is an error to be returned by Next.
+	err error
+
+	// ctx is the context of QueryContext, whose watch for
+	// cancellation finish ends once the query is complete.
+	ctx    context.Context
+	finish func()
+}
+
+// watch makes rs keep watching ctx for cancellation until the query is
+// complete, and report its cancellation as ctx's error.
+func (rs *rows) watch(ctx context.Context, finish func()) {
+	rs.tag, _ = ctx.Value(commandTagKey{}).(*CommandTag)
+	rs.ctx, rs.finish = ctx, finish
+}
+
+// unwatch ends the watch started by watch, once the query is complete
+// or the rows are closed.
+func (rs *rows) unwatch(err *error) {
+	if rs.finish == nil {
+		return
+	}
+	if *err != nil && *err != io.EOF {
+		*err = ctxErr(rs.ctx, *err)
+	}
+	if rs.done {
+		rs.finish()
+		rs.finish = nil
+	}
 }
 
 func (rs *rows) Close() error {
+	defer func() {
+		if rs.finish != nil {
+			rs.finish()
+			rs.finish = nil
+		}
+	}()
+
 	for {
 		err := rs.Next(nil)
 		switch err {
 		case nil:
 		case io.EOF:
+			if rs.HasNextResultSet() {
+				rs.NextResultSet()
+				continue
+			}
 			return nil
 		default:
 			return err
@@ -558,12 +1588,93 @@ func (rs *rows) Close() error {
 	panic("not reached")
 }
 
+// CommandTag implements CommandTagger.
+func (rs *rows) CommandTag() CommandTag {
+	return rs.lastTag
+}
+
+// setTag records the tag of a statement. Once the current result set
+// has ended, the statements read ahead of the next one leave its tag
+// as it is.
+func (rs *rows) setTag(tag CommandTag) {
+	if !rs.eos {
+		rs.lastTag = tag
+	}
+	if rs.tag != nil {
+		*rs.tag = tag
+	}
+}
+
 func (rs *rows) Columns() []string {
 	return rs.st.cols
 }
 
+// HasNextResultSet implements driver.RowsNextResultSet.
+func (rs *rows) HasNextResultSet() bool {
+	return rs.next != nil
+}
+
+// NextResultSet implements driver.RowsNextResultSet, skipping any rows
+// of the current result set that have not been read.
+func (rs *rows) NextResultSet() error {
+	for !rs.eos && !rs.done {
+		if err := rs.Next(nil); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	if rs.next == nil {
+		return io.EOF
+	}
+
+	rs.st, rs.next = rs.next, nil
+	rs.eos = false
+	rs.lastTag = ""
+	return nil
+}
+
+// readAhead reads the messages of a simple query up to the start of
+// the next result set, or to the end of the query, and returns the
+// first error the server reports on the way.
+func (rs *rows) readAhead() (err error) {
+	cn := rs.st.cn
+	for {
+		t, r := cn.recv1()
+		switch t {
+		case 'T':
+			cols, typs, fields := parseRowDescription(r)
+			rs.next = &stmt{cn: cn, query: rs.st.query, cols: cols, rowTyps: typs, fields: fields}
+			return err
+		case 'C':
+			// a statement that returns no rows
+			rs.setTag(CommandTag(r.string()))
+		case 'I':
+			// empty query
+		case 'E':
+			err = parseError(r)
+		case 'S':
+			cn.processParameterStatus(r)
+		case 'N':
+			// ignore
+		case 'Z':
+			cn.processReadyForQuery(r)
+			rs.done = true
+			return err
+		default:
+			errorf("unexpected message in simple query response: %q", t)
+		}
+	}
+}
+
 func (rs *rows) Next(dest []driver.Value) (err error) {
-	if rs.done {
+	defer rs.unwatch(&err)
+
+	if rs.err != nil {
+		err, rs.err = rs.err, nil
+		return err
+	}
+
+	if rs.done || rs.eos {
 		return io.EOF
 	}
 
@@ -574,9 +1685,21 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 		switch t {
 		case 'E':
 			err = parseError(r)
-		case 'C', 'S', 'N':
+		case 'S':
+			rs.st.cn.processParameterStatus(r)
+		case 'C':
+			rs.setTag(CommandTag(r.string()))
+			if rs.simple {
+				rs.eos = true
+				if err := rs.readAhead(); err != nil {
+					return err
+				}
+				return io.EOF
+			}
+		case 'N':
 			continue
 		case 'Z':
+			rs.st.cn.processReadyForQuery(r)
 			rs.done = true
 			if err != nil {
 				return err
@@ -590,7 +1713,7 @@ func (rs *rows) Next(dest []driver.Value) (err error) {
 					dest[i] = nil
 					continue
 				}
-				dest[i] = decode(r.next(l), rs.st.rowTyps[i])
+				dest[i] = rs.st.cn.decode(r.next(l), rs.st.rowTyps[i])
 			}
 			return
 		default:
@@ -669,8 +1792,11 @@ func parseEnviron(env []string) (out map[string]string) {
 			accrue("connect_timeout")
 		case "PGCLIENTENCODING":
 			accrue("client_encoding")
-			// skip PGDATESTYLE, PGTZ, PGGEQO, PGSYSCONFDIR,
-			// PGLOCALEDIR
+		case "PGDATESTYLE":
+			accrue("datestyle")
+		case "PGTZ":
+			accrue("timezone")
+			// skip PGGEQO, PGSYSCONFDIR, PGLOCALEDIR
 		}
 	}
 
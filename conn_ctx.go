@@ -0,0 +1,177 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Implement the context-aware driver interfaces. A statement is not
+// sent if its context is already done, and is cancelled with a cancel
+// request if the context is done while it runs, in which case the
+// context's error is returned. WithCommandTag reaches the statements
+// through their context too.
+
+func (cn *conn) ExecContext(ctx context.Context, query string, nargs []driver.NamedValue) (driver.Result, error) {
+	args, err := namedValues(nargs)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	finish := cn.watchCancel(ctx)
+	res, err := cn.Exec(query, args)
+	finish()
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	setCommandTag(ctx, res)
+	return res, nil
+}
+
+// QueryContext runs queries without arguments using the simple query
+// protocol, which allows several statements separated by semicolons;
+// the rows of each are read as a separate result set with
+// (*sql.Rows).NextResultSet. Queries with arguments are prepared.
+func (cn *conn) QueryContext(ctx context.Context, query string, nargs []driver.NamedValue) (driver.Rows, error) {
+	if len(nargs) > 0 {
+		return nil, driver.ErrSkip
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	finish := cn.watchCancel(ctx)
+	rs, err := cn.simpleQueryRows(query)
+	if err != nil {
+		finish()
+		return nil, ctxErr(ctx, err)
+	}
+
+	rs.watch(ctx, finish)
+	return rs, nil
+}
+
+func (st *stmt) ExecContext(ctx context.Context, nargs []driver.NamedValue) (driver.Result, error) {
+	args, err := namedValues(nargs)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	finish := st.cn.watchCancel(ctx)
+	res, err := st.Exec(args)
+	finish()
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+
+	setCommandTag(ctx, res)
+	return res, nil
+}
+
+func (st *stmt) QueryContext(ctx context.Context, nargs []driver.NamedValue) (driver.Rows, error) {
+	args, err := namedValues(nargs)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	finish := st.cn.watchCancel(ctx)
+	rs, err := st.Query(args)
+	if err != nil {
+		finish()
+		return nil, ctxErr(ctx, err)
+	}
+
+	rs.(*rows).watch(ctx, finish)
+	return rs, nil
+}
+
+// ctxErr returns the error of ctx in place of err if err is the
+// server's report of a query cancelled because ctx is done.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil && ErrorCode(err) == ErrCodeQueryCanceled {
+		return ctx.Err()
+	}
+	return err
+}
+
+func namedValues(nargs []driver.NamedValue) ([]driver.Value, error) {
+	args := make([]driver.Value, len(nargs))
+	for i, nv := range nargs {
+		if nv.Name != "" {
+			return nil, errors.New("pq: named parameters are not supported")
+		}
+		args[i] = nv.Value
+	}
+	return args, nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker. It passes
+// [16]byte, Interval, time.Duration, CompositeStruct and the address
+// types of net and net/netip through to encode, which knows how to send
+// them. A json.RawMessage is sent as text, and a nil one, like a
+// CompositeStruct of a nil pointer, as NULL.
+//
+// Other values get the default conversion. Once an Encoder is
+// registered, though, values that are not a driver.Valuer are passed
+// through as they are, since only the encoder may know their type.
+func (cn *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch v := nv.Value.(type) {
+	case [16]byte, Interval, time.Duration:
+		return nil
+	case CompositeStruct:
+		if v.null() {
+			nv.Value = nil
+		}
+		return nil
+	case net.IP, net.HardwareAddr, *net.IPNet, netip.Addr, netip.Prefix:
+		nv.Value = netValue(v)
+		return nil
+	case json.RawMessage:
+		if v == nil {
+			nv.Value = nil
+		} else {
+			nv.Value = string(v)
+		}
+		return nil
+	}
+	if _, ok := nv.Value.(driver.Valuer); !ok && !driver.IsValue(nv.Value) && registeredEncoders() {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+type commandTagKey struct{}
+
+// WithCommandTag returns a context that makes ExecContext and
+// QueryContext store the command tag of the statement they run in
+// *tag; for QueryContext, once the rows have been read to the end or
+// closed. The tag tells apart results that RowsAffected cannot, such as
+// "UPDATE 0" and "SELECT 0":
+//
+//	var tag pq.CommandTag
+//	_, err := db.ExecContext(pq.WithCommandTag(ctx, &tag), q)
+//	// tag.Command(), tag.RowsAffected()
+func WithCommandTag(ctx context.Context, tag *CommandTag) context.Context {
+	return context.WithValue(ctx, commandTagKey{}, tag)
+}
+
+func setCommandTag(ctx context.Context, res driver.Result) {
+	tag, _ := ctx.Value(commandTagKey{}).(*CommandTag)
+	if r, ok := res.(result); ok && tag != nil {
+		*tag = r.tag
+	}
+}
@@ -0,0 +1,338 @@
+package pq
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommandTag(t *testing.T) {
+	tests := []struct {
+		tag     CommandTag
+		command string
+		rows    int64
+	}{
+		{"INSERT 0 3", "INSERT", 3},
+		{"UPDATE 0", "UPDATE", 0},
+		{"SELECT 5", "SELECT", 5},
+		{"MERGE 2", "MERGE", 2},
+		{"FETCH 10", "FETCH", 10},
+		{"CREATE TABLE", "CREATE TABLE", 0},
+		{"", "", 0},
+	}
+
+	for _, test := range tests {
+		if c := test.tag.Command(); c != test.command {
+			t.Errorf("%q: expected command %q, got %q", test.tag, test.command, c)
+		}
+		if n := test.tag.RowsAffected(); n != test.rows {
+			t.Errorf("%q: expected %d rows, got %d", test.tag, test.rows, n)
+		}
+	}
+}
+
+func TestWithCommandTag(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	var tag CommandTag
+	ctx := WithCommandTag(context.Background(), &tag)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "CREATE TEMP TABLE temp (a int)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "CREATE TABLE" {
+		t.Fatalf("expected CREATE TABLE, got %q", tag)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE temp SET a = $1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Command() != "UPDATE" || tag.RowsAffected() != 0 {
+		t.Fatalf("expected UPDATE 0, got %q", tag)
+	}
+
+	r, err := tx.QueryContext(ctx, "SELECT generate_series(1, $1::int)", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r.Next() {
+	}
+	if err = r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if tag != "SELECT 3" {
+		t.Fatalf("expected SELECT 3, got %q", tag)
+	}
+}
+
+func TestCommandTagger(t *testing.T) {
+	var res driver.Result = parseComplete("UPDATE 3")
+	if tag := res.(CommandTagger).CommandTag(); tag != "UPDATE 3" {
+		t.Fatalf("expected UPDATE 3, got %q", tag)
+	}
+
+	rs := &rows{}
+	rs.setTag("SELECT 2")
+	rs.eos = true
+	rs.setTag("SET")
+	var dr driver.Rows = rs
+	if tag := dr.(CommandTagger).CommandTag(); tag != "SELECT 2" {
+		t.Fatalf("expected SELECT 2, got %q", tag)
+	}
+}
+
+func TestCommandTaggerRaw(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Raw(func(dc interface{}) error {
+		ex := dc.(driver.Execer)
+		if _, err := ex.Exec("CREATE TEMP TABLE temp (a int)", nil); err != nil {
+			return err
+		}
+		res, err := ex.Exec("INSERT INTO temp SELECT generate_series(1, 4)", nil)
+		if err != nil {
+			return err
+		}
+		if tag := res.(CommandTagger).CommandTag(); tag != "INSERT 0 4" {
+			t.Errorf("expected INSERT 0 4, got %q", tag)
+		}
+
+		rs, err := dc.(driver.QueryerContext).QueryContext(context.Background(), "SELECT 1; SELECT 2, 3", nil)
+		if err != nil {
+			return err
+		}
+		defer rs.Close()
+		for rs.Next(make([]driver.Value, 1)) == nil {
+		}
+		if tag := rs.(CommandTagger).CommandTag(); tag != "SELECT 1" {
+			t.Errorf("expected SELECT 1, got %q", tag)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextDoneBeforeSend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing is sent: the connection has no socket to send it on.
+	cn := &conn{}
+	if _, err := cn.ExecContext(ctx, "SELECT 1", nil); err != context.Canceled {
+		t.Errorf("ExecContext: expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := cn.QueryContext(ctx, "SELECT 1", nil); err != context.Canceled {
+		t.Errorf("QueryContext: expected %v, got %v", context.Canceled, err)
+	}
+	st := &stmt{cn: cn}
+	if _, err := st.ExecContext(ctx, nil); err != context.Canceled {
+		t.Errorf("stmt ExecContext: expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := st.QueryContext(ctx, nil); err != context.Canceled {
+		t.Errorf("stmt QueryContext: expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, "DO $$BEGIN PERFORM pg_sleep(10); END$$"); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// The watch goes on while the rows are read.
+	for q, args := range map[string][]interface{}{
+		"SELECT pg_sleep(0.1) FROM generate_series(1, 100)":     nil,
+		"SELECT pg_sleep(0.1) FROM generate_series(1, $1::int)": {100},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		r, err := db.QueryContext(ctx, q, args...)
+		if err != nil {
+			cancel()
+			t.Fatal(err)
+		}
+		for r.Next() {
+		}
+		if err := r.Err(); err != context.DeadlineExceeded {
+			t.Errorf("%s: expected %v, got %v", q, context.DeadlineExceeded, err)
+		}
+		r.Close()
+		cancel()
+	}
+
+	// The connection is still usable.
+	var n int
+	if err := db.QueryRow("SELECT 1").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("unexpected %d, %v", n, err)
+	}
+}
+
+func TestQueryerInterfaces(t *testing.T) {
+	var cni interface{} = &conn{}
+	if _, ok := cni.(driver.QueryerContext); !ok {
+		t.Fatal("Driver doesn't implement QueryerContext")
+	}
+
+	var rsi interface{} = &rows{}
+	if _, ok := rsi.(driver.RowsNextResultSet); !ok {
+		t.Fatal("rows don't implement RowsNextResultSet")
+	}
+}
+
+func TestMultipleResultSets(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	r, err := db.Query("SELECT 1; SET LOCAL search_path = public; SELECT 2, 'two' UNION ALL SELECT 3, 'three'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got []int
+	for {
+		for r.Next() {
+			var n int
+			var s sql.NullString
+			dest := []interface{}{&n}
+			if cols, _ := r.Columns(); len(cols) == 2 {
+				dest = append(dest, &s)
+			}
+			if err := r.Scan(dest...); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, n)
+		}
+		if !r.NextResultSet() {
+			break
+		}
+	}
+
+	if err = r.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("expected [1 2 3], got %v", got)
+	}
+}
+
+func TestSimpleQueryError(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		defer server.Close()
+		var h [5]byte
+		if _, err := io.ReadFull(server, h[:]); err != nil {
+			return
+		}
+		q := make([]byte, binary.BigEndian.Uint32(h[1:])-4)
+		if _, err := io.ReadFull(server, q); err != nil {
+			return
+		}
+
+		srv := &conn{c: server}
+		b := newWriteBuf('E')
+		b.byte('S')
+		b.string("ERROR")
+		b.byte('C')
+		b.string("42703")
+		b.byte('M')
+		b.string(`column "x" does not exist`)
+		b.byte(0)
+		srv.send(b)
+		b = newWriteBuf('Z')
+		b.byte('I')
+		srv.send(b)
+	}()
+
+	cn := &conn{c: client, buf: bufio.NewReader(client)}
+	rs, err := cn.simpleQueryRows("SELECT x; SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As for prepared queries, the error comes from Next.
+	err = rs.Next(nil)
+	if pe, ok := err.(PGError); !ok || pe.Get('C') != "42703" {
+		t.Fatalf("expected error 42703, got %#v", err)
+	}
+	if cn.txnStatus != txnStatusIdle {
+		t.Fatalf("expected idle connection, got %q", cn.txnStatus)
+	}
+}
+
+func TestMultipleResultSetsError(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	// An error before any result set is reported by Next, as it is
+	// for a query with arguments.
+	for q, args := range map[string][]interface{}{
+		"SELECT 1 / (random() * 0)::int; SELECT 1": nil,
+		"SELECT $1::int / (random() * 0)::int":     {1},
+	} {
+		r, err := db.Query(q, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		if r.Next() {
+			t.Fatalf("%s: unexpected row", q)
+		}
+		if _, ok := r.Err().(PGError); !ok {
+			t.Fatalf("%s: expected PGError, got %#v", q, r.Err())
+		}
+		r.Close()
+	}
+
+	r, err := db.Query("SELECT 1; SELECT 1 / (random() * 0)::int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if !r.Next() {
+		t.Fatalf("expected row, got error %v", r.Err())
+	}
+	if r.Next() {
+		t.Fatal("unexpected row")
+	}
+	if !r.NextResultSet() {
+		t.Fatalf("expected second result set, got error %v", r.Err())
+	}
+	if r.Next() {
+		t.Fatal("unexpected row")
+	}
+	if _, ok := r.Err().(PGError); !ok {
+		t.Fatalf("expected PGError, got %#v", r.Err())
+	}
+}
@@ -1,11 +1,16 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"net"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -465,3 +470,573 @@ FROM (VALUES (0::integer, NULL::text), (1, 'test string')) AS t;`)
 	for r.Next() {
 	}
 }
+
+func TestConnectTimeoutOption(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"":   0,
+		"0":  0,
+		"-3": 0,
+		"10": 10 * time.Second,
+	} {
+		if got := connectTimeout(Values{"connect_timeout": s}); got != want {
+			t.Errorf("connect_timeout=%q: expected %v, got %v", s, want, got)
+		}
+	}
+
+	var err error
+	func() {
+		defer errRecover(&err)
+		connectTimeout(Values{"connect_timeout": "soon"})
+	}()
+	if err == nil {
+		t.Fatal("expected error for invalid connect_timeout")
+	}
+}
+
+func TestKeepaliveOptions(t *testing.T) {
+	d := dialer(Values{"keepalives": "0"})
+	if d.KeepAlive >= 0 || d.KeepAliveConfig.Enable {
+		t.Fatalf("expected keepalives disabled, got %#v", d)
+	}
+
+	d = dialer(Values{
+		"keepalives_idle":     "30",
+		"keepalives_interval": "5",
+		"keepalives_count":    "0",
+	})
+	want := net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     30 * time.Second,
+		Interval: 5 * time.Second,
+		Count:    -1,
+	}
+	if d.KeepAliveConfig != want {
+		t.Fatalf("expected %#v, got %#v", want, d.KeepAliveConfig)
+	}
+}
+
+func TestStartupParams(t *testing.T) {
+	o := Values{
+		"host":                      "localhost",
+		"user":                      "bob",
+		"dbname":                    "pqgotest",
+		"connect_timeout":           "5",
+		"fallback_application_name": "fallback",
+		"search_path":               "app,public",
+		"options":                   `-c statement_timeout=5s --lock-timeout=1s -cDateStyle=ISO,\ MDY -W`,
+	}
+
+	expected := map[string]string{
+		"application_name":  "fallback",
+		"search_path":       "app,public",
+		"statement_timeout": "5s",
+		"lock_timeout":      "1s",
+		"DateStyle":         "ISO, MDY",
+		"options":           "-W",
+	}
+	if got := startupParams(o); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("Expected: %#v Got: %#v", expected, got)
+	}
+
+	o["application_name"] = "myapp"
+	if got := startupParams(o)["application_name"]; got != "myapp" {
+		t.Fatalf("expected application_name to override fallback, got %q", got)
+	}
+}
+
+func TestStartupDateStyle(t *testing.T) {
+	for _, c := range []struct {
+		o    Values
+		key  string
+		want string
+	}{
+		{Values{}, "datestyle", "ISO, MDY"},
+		{Values{"datestyle": "ISO, DMY"}, "datestyle", "ISO, DMY"},
+		{Values{"datestyle": "dmy"}, "datestyle", "ISO, dmy"},
+		{Values{"datestyle": "YMD, iso"}, "datestyle", "YMD, iso"},
+		{Values{"options": "-c DateStyle=DMY"}, "DateStyle", "ISO, DMY"},
+	} {
+		ps := startupParams(c.o)
+		if got := ps[c.key]; got != c.want {
+			t.Errorf("%v: expected %q, got %q", c.o, c.want, got)
+		}
+		if len(ps) != 1 {
+			t.Errorf("%v: expected one parameter, got %v", c.o, ps)
+		}
+	}
+
+	for _, ds := range []string{"SQL, DMY", "Postgres", "German"} {
+		err := func() (err error) {
+			defer errRecover(&err)
+			startupParams(Values{"datestyle": ds})
+			return nil
+		}()
+		if err == nil {
+			t.Errorf("%q: expected error", ds)
+		}
+	}
+
+	// The setting is refused before anything is dialed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	_, err = Open(fmt.Sprintf("host=127.0.0.1 port=%d sslmode=disable datestyle=SQL", port))
+	if err == nil || !strings.Contains(err.Error(), "datestyle") {
+		t.Errorf("expected datestyle error, got %v", err)
+	}
+}
+
+func TestConnDecodeTimes(t *testing.T) {
+	cn := &conn{parameterStatus: map[string]string{"DateStyle": "ISO, MDY", "TimeZone": "America/New_York"}}
+	ts := []byte("2001-02-03 04:05:06")
+
+	if v := cn.decode(ts, t_timestamp).(time.Time); v.Location() != time.UTC {
+		t.Errorf("expected UTC by default, got %v", v)
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	for zone, loc := range map[string]*time.Location{"utc": time.UTC, "local": time.Local, "session": ny} {
+		cn.timestampZone = zone
+		v := cn.decode(ts, t_timestamp).(time.Time)
+		if !v.Equal(time.Date(2001, 2, 3, 4, 5, 6, 0, loc)) {
+			t.Errorf("%s: unexpected %v", zone, v)
+		}
+		if got := string(cn.encode(v.In(time.UTC), t_timestamp)); got[:19] != string(ts) {
+			t.Errorf("%s: expected %s to be sent, got %s", zone, ts, got)
+		}
+	}
+
+	cn.timestampZone = "session"
+	for tz, offset := range map[string]int{
+		"<+03>-03":       3 * 3600,
+		"<-0330>+03:30":  -(3*3600 + 30*60),
+		"JST-9":          9 * 3600,
+		"<+0545>-5:45:0": 5*3600 + 45*60,
+	} {
+		cn.parameterStatus["TimeZone"] = tz
+		v := cn.decode(ts, t_timestamp).(time.Time)
+		if _, off := v.Zone(); off != offset || v.Hour() != 4 {
+			t.Errorf("%s: unexpected %v", tz, v)
+		}
+	}
+
+	cn.parameterStatus["TimeZone"] = "Nowhere/Else"
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for an unknown session TimeZone")
+			}
+		}()
+		cn.decode(ts, t_timestamp)
+	}()
+
+	cn.parameterStatus["DateStyle"] = "SQL, DMY"
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic for a non-ISO DateStyle")
+			}
+		}()
+		cn.decode([]byte("03/02/2001"), t_date)
+	}()
+	if v := cn.decode([]byte("1"), t_int4); v != int64(1) {
+		t.Errorf("unexpected %v", v)
+	}
+}
+
+func TestTimestampZoneOption(t *testing.T) {
+	if _, err := Open("timestamp_zone=paris"); err == nil {
+		t.Error("expected error for an invalid timestamp_zone")
+	}
+
+	// Only for the PGDATABASE and PGSSLMODE defaults.
+	openTestConn(t).Close()
+
+	db, err := sql.Open("postgres", "timestamp_zone=session TimeZone=Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var got time.Time
+	if err := db.QueryRow("SELECT '2001-02-03 04:05:06'::timestamp").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Location().String() != "Asia/Tokyo" || got.Hour() != 4 {
+		t.Errorf("unexpected %v", got)
+	}
+
+	var s string
+	in := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := db.QueryRow("SELECT $1::timestamp::text", in).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "2001-02-03 13:05:06" {
+		t.Errorf("unexpected %s", s)
+	}
+
+	if _, err := db.Exec("SET DateStyle = 'SQL, DMY'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT current_date").Scan(&got); err == nil {
+		t.Error("expected error for a non-ISO DateStyle")
+	}
+	if err := db.QueryRow("SELECT current_date::text").Scan(&s); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseOptsQuoting(t *testing.T) {
+	for in, want := range map[string]Values{
+		"":                          {},
+		"  host=a   port=5 ":        {"host": "a", "port": "5"},
+		"host = a port= 5":          {"host": "a", "port": "5"},
+		`options='-c a=b -c x=y'`:   {"options": "-c a=b -c x=y"},
+		`password='it\'s' user=''`:  {"password": "it's", "user": ""},
+		`password=a\ b\\c`:          {"password": `a b\c`},
+		"application_name='x\ty'":   {"application_name": "x\ty"},
+		"dbname='a b'\tuser=c\nx=y": {"dbname": "a b", "user": "c", "x": "y"},
+	} {
+		o := Values{}
+		parseOpts(in, o)
+		if !reflect.DeepEqual(o, want) {
+			t.Errorf("%q: expected %v, got %v", in, want, o)
+		}
+	}
+
+	for _, in := range []string{"host", "host=a port", "=a", "host='a", "a b=c"} {
+		err := func() (err error) {
+			defer errRecover(&err)
+			parseOpts(in, Values{})
+			return nil
+		}()
+		if err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+// TestOpenStartupMessage checks the startup parameters Open sends for a
+// conninfo string, with a listener in place of the server.
+func TestOpenStartupMessage(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	params := make(chan map[string]string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		var n [4]byte
+		if _, err := io.ReadFull(c, n[:]); err != nil {
+			return
+		}
+		b := make([]byte, binary.BigEndian.Uint32(n[:])-4)
+		if _, err := io.ReadFull(c, b); err != nil {
+			return
+		}
+		ps := make(map[string]string)
+		fields := strings.Split(string(b[4:]), "\x00")
+		for i := 0; i+1 < len(fields) && fields[i] != ""; i += 2 {
+			ps[fields[i]] = fields[i+1]
+		}
+		params <- ps
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	Open(fmt.Sprintf(`host=127.0.0.1 port=%d sslmode=disable user=bob options='-c search_path=a,b -c lock_timeout=1s' application_name='my app'`, port))
+
+	ps := <-params
+	for k, want := range map[string]string{
+		"user":             "bob",
+		"search_path":      "a,b",
+		"lock_timeout":     "1s",
+		"application_name": "my app",
+	} {
+		if ps[k] != want {
+			t.Errorf("%s: expected %q, got %q", k, want, ps[k])
+		}
+	}
+	if _, ok := ps["options"]; ok {
+		t.Errorf("unexpected options %q", ps["options"])
+	}
+}
+
+func TestParseOptsValueWithEquals(t *testing.T) {
+	o := make(Values)
+	parseOpts("options=-csearch_path=foo", o)
+	if v := o.Get("options"); v != "-csearch_path=foo" {
+		t.Fatalf("expected %q, got %q", "-csearch_path=foo", v)
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	for s, want := range map[string]int{
+		"9.6.3":                90603,
+		"9.4":                  90400,
+		"10.1":                 100001,
+		"14.5 (Debian 14.5-1)": 140005,
+		"16beta2":              160000,
+		"":                     0,
+	} {
+		if got := parseServerVersion(s); got != want {
+			t.Errorf("%q: expected %d, got %d", s, want, got)
+		}
+	}
+}
+
+func TestServerParameters(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Raw(func(dc interface{}) error {
+		si, ok := dc.(ServerInfo)
+		if !ok {
+			t.Fatalf("expected a ServerInfo, got %T", dc)
+		}
+
+		if si.ParameterStatus("server_encoding") == "" {
+			t.Error("expected server_encoding to be reported")
+		}
+
+		if si.ServerVersion() < 80000 {
+			t.Errorf("unexpected server version %d", si.ServerVersion())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.ExecContext(context.Background(), "SET application_name = 'pqgotest'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Raw(func(dc interface{}) error {
+		if v := dc.(ServerInfo).ParameterStatus("application_name"); v != "pqgotest" {
+			t.Errorf("expected application_name to be tracked, got %q", v)
+		}
+		return nil
+	})
+}
+
+func TestTransactionStatus(t *testing.T) {
+	cn := &conn{txnStatus: txnStatusIdle}
+	if !cn.IsValid() {
+		t.Fatal("expected idle connection to be valid")
+	}
+
+	for _, s := range []transactionStatus{
+		txnStatusIdleInTransaction,
+		txnStatusInFailedTransaction,
+	} {
+		cn.txnStatus = s
+		if cn.IsValid() {
+			t.Errorf("expected connection %v to be invalid", s)
+		}
+
+		if _, err := cn.Begin(); err != ErrInTransaction {
+			t.Errorf("expected ErrInTransaction for Begin while %v, got %v", s, err)
+		}
+	}
+}
+
+func TestCommitInFailedTransaction(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tx.Exec("SELECT error")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := tx.Commit(); err != ErrInFailedTransaction {
+		t.Fatalf("expected ErrInFailedTransaction, got %v", err)
+	}
+}
+
+func TestBeginQuery(t *testing.T) {
+	tests := []struct {
+		opts       driver.TxOptions
+		deferrable bool
+		want       string
+	}{
+		{driver.TxOptions{}, false, "BEGIN"},
+		{driver.TxOptions{ReadOnly: true}, false, "BEGIN READ ONLY"},
+		{
+			driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelRepeatableRead)},
+			false,
+			"BEGIN ISOLATION LEVEL REPEATABLE READ",
+		},
+		{
+			driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable), ReadOnly: true},
+			true,
+			"BEGIN ISOLATION LEVEL SERIALIZABLE READ ONLY DEFERRABLE",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := beginQuery(test.opts, test.deferrable)
+		if err != nil {
+			t.Errorf("%+v: %v", test.opts, err)
+		} else if got != test.want {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.want, got)
+		}
+	}
+
+	for _, test := range []struct {
+		opts       driver.TxOptions
+		deferrable bool
+	}{
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSnapshot)}, false},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelLinearizable)}, false},
+		{driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSerializable)}, true},
+	} {
+		if _, err := beginQuery(test.opts, test.deferrable); err == nil {
+			t.Errorf("%+v: expected error", test.opts)
+		}
+	}
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx := Deferrable(context.Background())
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	var level, readOnly, deferrable string
+	err = tx.QueryRow("SELECT current_setting('transaction_isolation'), "+
+		"current_setting('transaction_read_only'), "+
+		"current_setting('transaction_deferrable')").Scan(&level, &readOnly, &deferrable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if level != "serializable" || readOnly != "on" || deferrable != "on" {
+		t.Fatalf("unexpected transaction settings: %s, read only %s, deferrable %s",
+			level, readOnly, deferrable)
+	}
+}
+
+func TestParseCompleteInsertOid(t *testing.T) {
+	res := parseComplete("INSERT 16388 1")
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("expected 1 row affected, not %d", n)
+	}
+	if id, err := res.LastInsertId(); err != nil || id != 16388 {
+		t.Fatalf("expected LastInsertId 16388, got %d, %v", id, err)
+	}
+
+	res = parseComplete("INSERT 0 3")
+	if _, err := res.LastInsertId(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestLastInsertIdReturning(t *testing.T) {
+	// Only for the PGDATABASE and PGSSLMODE defaults.
+	openTestConn(t).Close()
+
+	rdb, err := sql.Open("postgres", "last_insert_id=returning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+
+	tx, err := rdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("CREATE TEMP TABLE temp (id serial, a int)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		r, err := tx.Exec("INSERT INTO temp (a) VALUES ($1) RETURNING id", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, err := r.LastInsertId(); err != nil || id != i {
+			t.Fatalf("expected LastInsertId %d, got %d, %v", i, id, err)
+		}
+	}
+
+	r, err := tx.Exec("INSERT INTO temp (a) VALUES (3) RETURNING id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := r.LastInsertId(); err != nil || id != 3 {
+		t.Fatalf("expected LastInsertId 3, got %d, %v", id, err)
+	}
+
+	r, err = tx.Exec("INSERT INTO temp (a) VALUES (4)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LastInsertId(); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported without RETURNING, got %v", err)
+	}
+}
+
+func TestConnectTimeoutCloses(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Accept, but never answer.
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	_, err = Open(fmt.Sprintf("host=127.0.0.1 port=%d sslmode=disable connect_timeout=1", port))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expected a timeout, got %#v", err)
+	}
+
+	c := <-accepted
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, c); err != nil {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+}
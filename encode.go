@@ -4,10 +4,24 @@ import (
 	"database/sql/driver"
 	"encoding/hex"
 	"fmt"
+	"net"
+	"net/netip"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// encodes reports whether encode knows the type of x, which is either
+// a driver.Value or one of the types CheckNamedValue passes through.
+func encodes(x interface{}) bool {
+	switch x.(type) {
+	case [16]byte, Interval, time.Duration, CompositeStruct,
+		net.IP, net.HardwareAddr, *net.IPNet, netip.Addr, netip.Prefix:
+		return true
+	}
+	return driver.IsValue(x)
+}
+
 func encode(x interface{}, pgtypoid oid) []byte {
 	switch v := x.(type) {
 	case int64:
@@ -29,7 +43,47 @@ func encode(x interface{}, pgtypoid oid) []byte {
 	case bool:
 		return []byte(fmt.Sprintf("%t", v))
 	case time.Time:
-		return []byte(v.Format(time.RFC3339Nano))
+		return formatTs(v, pgtypoid)
+	case [16]byte:
+		if pgtypoid != t_uuid {
+			errorf("encode: [16]byte is only supported for uuid, not type %d", pgtypoid)
+		}
+		return UUID(v).appendText(nil)
+	case Interval:
+		return []byte(v.String())
+	case CompositeStruct:
+		cv, err := v.Value()
+		if err != nil {
+			panic(err)
+		}
+		if cv == nil {
+			errorf("encode: CompositeStruct of a nil pointer")
+		}
+		return encode(cv, pgtypoid)
+	case time.Duration:
+		// Other than for intervals, send nanoseconds as the default
+		// conversion of database/sql would.
+		if pgtypoid == t_interval {
+			return []byte(IntervalOf(v).String())
+		}
+		return []byte(fmt.Sprintf("%d", int64(v)))
+	case net.IP:
+		// These were sent as their bytes before encode knew them.
+		if pgtypoid == t_bytea {
+			return encode([]byte(v), pgtypoid)
+		}
+		return []byte(v.String())
+	case net.HardwareAddr:
+		if pgtypoid == t_bytea {
+			return encode([]byte(v), pgtypoid)
+		}
+		return []byte(v.String())
+	case *net.IPNet:
+		return []byte(v.String())
+	case netip.Addr:
+		return []byte(v.String())
+	case netip.Prefix:
+		return []byte(v.String())
 	default:
 		errorf("encode: unknown type for %T", v)
 	}
@@ -47,16 +101,13 @@ func decode(s []byte, typ oid) interface{} {
 			errorf("%s", err)
 		}
 		return d
-	case t_timestamptz:
-		return mustParse("2006-01-02 15:04:05-07", typ, s)
-	case t_timestamp:
-		return mustParse("2006-01-02 15:04:05", typ, s)
-	case t_time:
-		return mustParse("15:04:05", typ, s)
-	case t_timetz:
-		return mustParse("15:04:05-07", typ, s)
-	case t_date:
-		return mustParse("2006-01-02", typ, s)
+	case t_timestamptz, t_timestamp, t_date:
+		if inf, ok := decodeInfinity(s); ok {
+			return inf
+		}
+		return mustParse(typ, s)
+	case t_time, t_timetz:
+		return mustParse(typ, s)
 	case t_bool:
 		return s[0] == 't'
 	case t_int8, t_int2, t_int4:
@@ -75,32 +126,254 @@ func decode(s []byte, typ oid) interface{} {
 			errorf("%s", err)
 		}
 		return f
+	case t_inet, t_cidr:
+		return decodeInet(s, typ)
+	case t_macaddr, t_macaddr8:
+		return decodeMACAddr(s)
 	}
 
 	return s
 }
 
-func mustParse(f string, typ oid, s []byte) time.Time {
-	str := string(s)
+var (
+	infinityTsEnabled  = false
+	infinityTsNegative time.Time
+	infinityTsPositive time.Time
+)
 
-	// Special case until time.Parse bug is fixed:
-	// http://code.google.com/p/go/issues/detail?id=3487
-	if str[len(str)-2] == '.' {
-		str += "0"
+// EnableInfinityTs makes date, timestamp and timestamptz values of
+// -infinity and infinity scan as negative and positive, and time.Time
+// parameters at or before negative, or at or after positive, be sent
+// as -infinity and infinity. Without it, infinite values are returned
+// as the []byte "-infinity" and "infinity", which scan into strings but
+// not into time.Time.
+//
+// EnableInfinityTs is meant to be called before the driver is used.
+// Calling it again with the same times does nothing; it panics if it
+// is called again with other times, or if negative is not before
+// positive.
+func EnableInfinityTs(negative time.Time, positive time.Time) {
+	if infinityTsEnabled {
+		if negative.Equal(infinityTsNegative) && positive.Equal(infinityTsPositive) {
+			return
+		}
+		panic("pq: EnableInfinityTs called again with other times")
+	}
+	if !negative.Before(positive) {
+		panic("pq: infinity timestamps: negative must be before positive")
 	}
+	infinityTsEnabled = true
+	infinityTsNegative = negative
+	infinityTsPositive = positive
+}
 
-	// check for a 30-minute-offset timezone
-	if (typ == t_timestamptz || typ == t_timetz) &&
-		str[len(str)-3] == ':' {
-		f += ":00"
+// disableInfinityTs undoes EnableInfinityTs, for tests.
+func disableInfinityTs() {
+	infinityTsEnabled = false
+}
+
+// decodeInfinity returns the value of s if it is infinite.
+func decodeInfinity(s []byte) (interface{}, bool) {
+	var t time.Time
+	switch string(s) {
+	case "infinity":
+		t = infinityTsPositive
+	case "-infinity":
+		t = infinityTsNegative
+	default:
+		return nil, false
+	}
+	if !infinityTsEnabled {
+		return append([]byte(nil), s...), true
 	}
-	t, err := time.Parse(f, str)
+	return t, true
+}
+
+// mustParse parses the ISO format of the date and time types, with the
+// years beyond 9999 and BC dates the server allows, and fractional
+// seconds.
+func mustParse(typ oid, s []byte) time.Time {
+	t, err := parseTs(typ, string(s))
 	if err != nil {
 		errorf("decode: %s", err)
 	}
 	return t
 }
 
+func parseTs(typ oid, str string) (time.Time, error) {
+	p := tsParser{s: str}
+	year, month, day := 0, 1, 1
+	var hour, minute, sec, nsec, offset int
+
+	hasDate := typ == t_date || typ == t_timestamp || typ == t_timestamptz
+	hasTime := typ != t_date
+	hasZone := typ == t_timestamptz || typ == t_timetz
+
+	bc := false
+	if hasDate {
+		if strings.HasSuffix(p.s, " BC") {
+			bc, p.s = true, p.s[:len(p.s)-3]
+		}
+		year = p.digits(4, 0)
+		p.expect('-')
+		month = p.digits(2, 2)
+		p.expect('-')
+		day = p.digits(2, 2)
+		if hasTime {
+			p.expect(' ')
+		}
+	}
+	if hasTime {
+		hour = p.digits(2, 2)
+		p.expect(':')
+		minute = p.digits(2, 2)
+		p.expect(':')
+		sec = p.digits(2, 2)
+		if p.peek() == '.' {
+			p.i++
+			start := p.i
+			frac := p.digits(1, 0)
+			// Scale to nanoseconds; the server sends at most six
+			// digits.
+			for n := p.i - start; n < 9; n++ {
+				frac *= 10
+			}
+			for n := p.i - start; n > 9; n-- {
+				frac /= 10
+			}
+			nsec = frac
+		}
+	}
+	if hasZone {
+		sign := 1
+		switch p.peek() {
+		case '-':
+			sign = -1
+		case '+':
+		default:
+			p.fail()
+		}
+		p.i++
+		offset = p.digits(2, 2) * 3600
+		for mult := 60; mult > 0 && p.peek() == ':'; mult /= 60 {
+			p.i++
+			offset += p.digits(2, 2) * mult
+		}
+		offset *= sign
+	}
+	if p.i != len(p.s) {
+		p.fail()
+	}
+	if p.err || month < 1 || month > 12 || day < 1 || day > 31 || hour > 24 || minute > 59 || sec > 60 {
+		return time.Time{}, fmt.Errorf("invalid %s %q", typeNames[typ], str)
+	}
+
+	if bc {
+		// 1 BC is year 0, as in ISO 8601.
+		year = 1 - year
+	}
+
+	if !hasZone {
+		return time.Date(year, time.Month(month), day, hour, minute, sec, nsec, time.UTC), nil
+	}
+
+	// Prefer the local time zone to a fixed one where it has the
+	// offset, as time.Parse does.
+	t := time.Date(year, time.Month(month), day, hour, minute, sec, nsec, time.FixedZone("", offset))
+	if _, off := t.In(time.Local).Zone(); off == offset {
+		t = t.In(time.Local)
+	}
+	return t, nil
+}
+
+// tsParser reads the fields of a date or time. Once it has failed it
+// stops reading.
+type tsParser struct {
+	s   string
+	i   int
+	err bool
+}
+
+func (p *tsParser) peek() byte {
+	if p.err || p.i >= len(p.s) {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *tsParser) expect(c byte) {
+	if p.peek() != c {
+		p.fail()
+		return
+	}
+	p.i++
+}
+
+// digits reads a number of at least least digits, and of at most most
+// digits unless most is 0.
+func (p *tsParser) digits(least, most int) int {
+	if p.err {
+		return 0
+	}
+	start, n := p.i, 0
+	for p.i < len(p.s) && '0' <= p.s[p.i] && p.s[p.i] <= '9' && (most == 0 || p.i-start < most) {
+		n = n*10 + int(p.s[p.i]-'0')
+		p.i++
+		if n > 1e9 {
+			p.fail()
+			return 0
+		}
+	}
+	if p.i-start < least {
+		p.fail()
+	}
+	return n
+}
+
+func (p *tsParser) fail() {
+	p.err = true
+}
+
+// formatTs formats t for a parameter of type typ, which may be unknown.
+// Years before 1 are sent as BC dates, and with EnableInfinityTs,
+// times beyond the sentinels as infinite.
+func formatTs(t time.Time, typ oid) []byte {
+	switch typ {
+	case t_time:
+		return []byte(t.Format("15:04:05.999999999"))
+	case t_timetz:
+		return []byte(t.Format("15:04:05.999999999Z07:00:00"))
+	}
+
+	if infinityTsEnabled {
+		if !t.After(infinityTsNegative) {
+			return []byte("-infinity")
+		}
+		if !t.Before(infinityTsPositive) {
+			return []byte("infinity")
+		}
+	}
+
+	year, bc := t.Year(), false
+	if year <= 0 {
+		year, bc = 1-year, true
+	}
+
+	b := strconv.AppendInt(nil, int64(year), 10)
+	for len(b) < 4 {
+		b = append([]byte{'0'}, b...)
+	}
+	if typ == t_date {
+		b = t.AppendFormat(b, "-01-02")
+	} else {
+		b = t.AppendFormat(b, "-01-02 15:04:05.999999999Z07:00:00")
+	}
+	if bc {
+		b = append(b, " BC"...)
+	}
+	return b
+}
+
 type NullTime struct {
 	Time  time.Time
 	Valid bool // Valid is true if Time is not NULL
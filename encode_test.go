@@ -162,3 +162,162 @@ func TestByteToText(t *testing.T) {
 		t.Fatalf("expected %v but got %v", b, result)
 	}
 }
+
+func TestParseTs(t *testing.T) {
+	for _, c := range []struct {
+		typ  oid
+		in   string
+		want time.Time
+	}{
+		{t_timestamp, "2001-02-03 04:05:06", time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)},
+		{t_timestamp, "2001-02-03 04:05:06.123456", time.Date(2001, 2, 3, 4, 5, 6, 123456000, time.UTC)},
+		{t_timestamp, "2001-02-03 04:05:06.5", time.Date(2001, 2, 3, 4, 5, 6, 500000000, time.UTC)},
+		{t_timestamp, "0044-03-15 12:00:00 BC", time.Date(-43, 3, 15, 12, 0, 0, 0, time.UTC)},
+		{t_timestamp, "12345-06-07 00:00:00", time.Date(12345, 6, 7, 0, 0, 0, 0, time.UTC)},
+		{t_timestamptz, "2001-02-03 04:05:06.25-07", time.Date(2001, 2, 3, 11, 5, 6, 250000000, time.UTC)},
+		{t_timestamptz, "2001-02-03 04:05:06+05:30", time.Date(2001, 2, 2, 22, 35, 6, 0, time.UTC)},
+		{t_timestamptz, "1900-01-01 00:00:00+04:56:02", time.Date(1899, 12, 31, 19, 3, 58, 0, time.UTC)},
+		{t_timestamptz, "0001-01-01 00:00:00+00 BC", time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{t_date, "2001-02-03", time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{t_date, "4713-01-01 BC", time.Date(-4712, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{t_date, "294276-12-31", time.Date(294276, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{t_time, "04:05:06.000001", time.Date(0, 1, 1, 4, 5, 6, 1000, time.UTC)},
+		{t_time, "24:00:00", time.Date(0, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{t_timetz, "04:05:06.789-08", time.Date(0, 1, 1, 12, 5, 6, 789000000, time.UTC)},
+	} {
+		got, err := parseTs(c.typ, c.in)
+		if err != nil {
+			t.Errorf("%s: %v", c.in, err)
+			continue
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("%s: expected %v, got %v", c.in, c.want, got)
+		}
+	}
+
+	for _, c := range []struct {
+		typ oid
+		in  string
+	}{
+		{t_timestamp, "2001-02-03"},
+		{t_timestamp, "2001-02-03 04:05:06+00"},
+		{t_timestamptz, "2001-02-03 04:05:06"},
+		{t_timestamp, "2001-13-03 04:05:06"},
+		{t_date, "01-02-2001"},
+		{t_date, "2001-02-03 AD"},
+		{t_time, "4:05:06"},
+		{t_time, "04:05:06."},
+	} {
+		if _, err := parseTs(c.typ, c.in); err == nil {
+			t.Errorf("%s: expected error", c.in)
+		}
+	}
+}
+
+func TestFormatTs(t *testing.T) {
+	loc := time.FixedZone("", -(4*3600 + 56*60 + 2))
+	for _, c := range []struct {
+		in   time.Time
+		typ  oid
+		want string
+	}{
+		{time.Date(2001, 2, 3, 4, 5, 6, 123456000, time.UTC), t_timestamptz, "2001-02-03 04:05:06.123456Z"},
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, loc), t_unknown, "1900-01-01 00:00:00-04:56:02"},
+		{time.Date(-43, 3, 15, 12, 0, 0, 0, time.UTC), t_timestamp, "0044-03-15 12:00:00Z BC"},
+		{time.Date(12345, 6, 7, 0, 0, 0, 0, time.UTC), t_timestamp, "12345-06-07 00:00:00Z"},
+		{time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC), t_date, "0001-01-01 BC"},
+		{time.Date(2001, 2, 3, 4, 5, 6, 1000, time.UTC), t_time, "04:05:06.000001"},
+		{time.Date(2001, 2, 3, 4, 5, 6, 0, time.FixedZone("", 3600)), t_timetz, "04:05:06+01:00:00"},
+	} {
+		if got := string(formatTs(c.in, c.typ)); got != c.want {
+			t.Errorf("%v: expected %s, got %s", c.in, c.want, got)
+		}
+	}
+}
+
+func TestInfinityTs(t *testing.T) {
+	defer disableInfinityTs()
+
+	if v := decode([]byte("infinity"), t_timestamptz); string(v.([]byte)) != "infinity" {
+		t.Errorf("expected raw infinity, got %v", v)
+	}
+
+	neg := time.Date(-1000, 1, 1, 0, 0, 0, 0, time.UTC)
+	pos := time.Date(100000, 1, 1, 0, 0, 0, 0, time.UTC)
+	EnableInfinityTs(neg, pos)
+
+	for _, typ := range []oid{t_timestamptz, t_timestamp, t_date} {
+		if v := decode([]byte("-infinity"), typ); v != neg {
+			t.Errorf("%d: expected %v, got %v", typ, neg, v)
+		}
+		if v := decode([]byte("infinity"), typ); v != pos {
+			t.Errorf("%d: expected %v, got %v", typ, pos, v)
+		}
+	}
+
+	for in, want := range map[time.Time]string{
+		neg:                   "-infinity",
+		neg.AddDate(-1, 0, 0): "-infinity",
+		pos:                   "infinity",
+		pos.AddDate(1, 0, 0):  "infinity",
+	} {
+		if got := string(encode(in, t_timestamptz)); got != want {
+			t.Errorf("%v: expected %s, got %s", in, want, got)
+		}
+	}
+
+	// Enabling again with the same times is allowed, but not with others.
+	EnableInfinityTs(neg, pos.In(time.FixedZone("", 3600)))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic from a second EnableInfinityTs with other times")
+			}
+		}()
+		EnableInfinityTs(neg, pos.AddDate(1, 0, 0))
+	}()
+	if infinityTsPositive != pos {
+		t.Errorf("expected %v, got %v", pos, infinityTsPositive)
+	}
+}
+
+func TestInfinityTsRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	var s string
+	if err := db.QueryRow("SELECT 'infinity'::timestamptz").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "infinity" {
+		t.Errorf("expected infinity, got %s", s)
+	}
+
+	defer disableInfinityTs()
+	neg := time.Date(-1000, 1, 1, 0, 0, 0, 0, time.UTC)
+	pos := time.Date(100000, 1, 1, 0, 0, 0, 0, time.UTC)
+	EnableInfinityTs(neg, pos)
+
+	var got time.Time
+	if err := db.QueryRow("SELECT '-infinity'::date").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(neg) {
+		t.Errorf("expected %v, got %v", neg, got)
+	}
+
+	if err := db.QueryRow("SELECT $1::timestamptz::text", pos).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "infinity" {
+		t.Errorf("expected infinity, got %s", s)
+	}
+
+	bc := time.Date(-43, 3, 15, 12, 0, 0, 123456000, time.UTC)
+	if err := db.QueryRow("SELECT $1::timestamp", bc).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(bc) {
+		t.Errorf("expected %v, got %v", bc, got)
+	}
+}
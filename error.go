@@ -2,6 +2,7 @@ package pq
 
 import (
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -18,6 +19,17 @@ const (
 	Elog     = "LOG"
 )
 
+// SQLSTATE codes that the driver acts on. See
+// http://www.postgresql.org/docs/current/static/errcodes-appendix.html
+// for the full list.
+const (
+	ErrCodeSerializationFailure = "40001"
+	ErrCodeDeadlockDetected     = "40P01"
+
+	ErrCodeObjectNotInPrerequisiteState = "55000"
+	ErrCodeQueryCanceled                = "57014"
+)
+
 type Error error
 
 type PGError interface {
@@ -54,6 +66,16 @@ func (err *pgError) Error() string {
 	return "pq: " + s[1:]
 }
 
+// ErrorCode returns the SQLSTATE code of err if it is, or wraps, a
+// PGError, and "" otherwise.
+func ErrorCode(err error) string {
+	var pgerr PGError
+	if errors.As(err, &pgerr) {
+		return pgerr.Get('C')
+	}
+	return ""
+}
+
 func errorf(s string, args ...interface{}) {
 	panic(Error(fmt.Errorf("pq: %s", fmt.Sprintf(s, args...))))
 }
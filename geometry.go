@@ -0,0 +1,562 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Point is a point value.
+type Point struct {
+	X, Y float64
+}
+
+// LineSegment is an lseg value, the segment between two points.
+type LineSegment [2]Point
+
+// Box is a box value. The server stores the upper right corner first
+// and the lower left one second, whichever corners it is given.
+type Box [2]Point
+
+// Path is a path value, a list of points that is either open or, like
+// a polygon, closed. A nil Points is NULL.
+type Path struct {
+	Points []Point
+	Closed bool
+}
+
+// Polygon is a polygon value. A nil Polygon is NULL.
+type Polygon []Point
+
+// Line is a line value, the infinite line of the points for which
+// A*x + B*y + C = 0.
+type Line struct {
+	A, B, C float64
+}
+
+// Circle is a circle value.
+type Circle struct {
+	Center Point
+	Radius float64
+}
+
+// geomParser reads the text format of the geometric types. Once it has
+// failed it stops reading and returns zero values.
+type geomParser struct {
+	s   string
+	i   int
+	err error
+}
+
+func (p *geomParser) skipSpace() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+func (p *geomParser) peek() byte {
+	p.skipSpace()
+	if p.err != nil || p.i == len(p.s) {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *geomParser) expect(c byte) {
+	if p.peek() != c {
+		p.fail()
+		return
+	}
+	p.i++
+}
+
+func (p *geomParser) float() float64 {
+	p.skipSpace()
+	if p.err != nil {
+		return 0
+	}
+	j := p.i
+	for j < len(p.s) && !strings.ContainsRune(",)]}> ", rune(p.s[j])) {
+		j++
+	}
+	f, err := strconv.ParseFloat(p.s[p.i:j], 64)
+	if err != nil {
+		p.fail()
+		return 0
+	}
+	p.i = j
+	return f
+}
+
+func (p *geomParser) point() Point {
+	p.expect('(')
+	x := p.float()
+	p.expect(',')
+	y := p.float()
+	p.expect(')')
+	return Point{x, y}
+}
+
+// points reads a list of points in the brackets open and close.
+func (p *geomParser) points(open, close byte) []Point {
+	p.expect(open)
+	var pts []Point
+	for p.err == nil {
+		pts = append(pts, p.point())
+		if p.peek() != ',' {
+			break
+		}
+		p.i++
+	}
+	p.expect(close)
+	return pts
+}
+
+func (p *geomParser) fail() {
+	if p.err == nil {
+		p.err = errors.New("syntax error")
+	}
+}
+
+// done checks that all of the input has been read.
+func (p *geomParser) done(typ string) error {
+	if p.peek() != 0 {
+		p.fail()
+	}
+	if p.err != nil {
+		return fmt.Errorf("pq: invalid %s %q", typ, p.s)
+	}
+	return nil
+}
+
+// geomText returns the text of a value scanned into a geometric type.
+func geomText(value interface{}, typ string) (string, error) {
+	switch v := value.(type) {
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("pq: cannot scan %T into %s", value, typ)
+}
+
+func appendGeomFloat(b []byte, f float64) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return append(b, "Infinity"...)
+	case math.IsInf(f, -1):
+		return append(b, "-Infinity"...)
+	}
+	return strconv.AppendFloat(b, f, 'g', -1, 64)
+}
+
+func appendPoint(b []byte, pt Point) []byte {
+	b = append(b, '(')
+	b = appendGeomFloat(b, pt.X)
+	b = append(b, ',')
+	b = appendGeomFloat(b, pt.Y)
+	return append(b, ')')
+}
+
+func appendPoints(b []byte, pts []Point, open, close byte) []byte {
+	b = append(b, open)
+	for i, pt := range pts {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendPoint(b, pt)
+	}
+	return append(b, close)
+}
+
+// The binary formats are made of float8 values, with a count of points
+// for path and polygon.
+
+func appendFloats(b []byte, fs ...float64) []byte {
+	for _, f := range fs {
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+	}
+	return b
+}
+
+func readFloats(data []byte, fs ...*float64) {
+	for i, f := range fs {
+		*f = math.Float64frombits(binary.BigEndian.Uint64(data[8*i:]))
+	}
+}
+
+func appendBinaryPoints(b []byte, pts []Point) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(pts)))
+	for _, pt := range pts {
+		b = appendFloats(b, pt.X, pt.Y)
+	}
+	return b
+}
+
+func readBinaryPoints(data []byte, typ string) ([]Point, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("pq: invalid binary %s", typ)
+	}
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(len(data)) != 16*uint64(n) {
+		return nil, fmt.Errorf("pq: invalid binary %s", typ)
+	}
+
+	pts := make([]Point, n)
+	for i := range pts {
+		readFloats(data[16*i:], &pts[i].X, &pts[i].Y)
+	}
+	return pts, nil
+}
+
+func checkBinaryLen(data []byte, n int, typ string) error {
+	if len(data) != n {
+		return fmt.Errorf("pq: invalid binary %s of length %d", typ, len(data))
+	}
+	return nil
+}
+
+// String formats pt as the server does, as in (1,2).
+func (pt Point) String() string {
+	return string(appendPoint(nil, pt))
+}
+
+// Scan implements the Scanner interface.
+func (pt *Point) Scan(value interface{}) error {
+	s, err := geomText(value, "Point")
+	if err != nil {
+		return err
+	}
+	p := geomParser{s: s}
+	v := p.point()
+	if err := p.done("point"); err != nil {
+		return err
+	}
+	*pt = v
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (pt Point) Value() (driver.Value, error) {
+	return pt.String(), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of point.
+func (pt Point) MarshalBinary() ([]byte, error) {
+	return appendFloats(nil, pt.X, pt.Y), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (pt *Point) UnmarshalBinary(data []byte) error {
+	if err := checkBinaryLen(data, 16, "point"); err != nil {
+		return err
+	}
+	readFloats(data, &pt.X, &pt.Y)
+	return nil
+}
+
+// String formats l as the server does, as in [(1,2),(3,4)].
+func (l LineSegment) String() string {
+	return string(appendPoints(nil, l[:], '[', ']'))
+}
+
+// Scan implements the Scanner interface.
+func (l *LineSegment) Scan(value interface{}) error {
+	s, err := geomText(value, "LineSegment")
+	if err != nil {
+		return err
+	}
+	p := geomParser{s: s}
+	pts := p.points('[', ']')
+	if len(pts) != 2 {
+		p.fail()
+	}
+	if err := p.done("lseg"); err != nil {
+		return err
+	}
+	copy(l[:], pts)
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (l LineSegment) Value() (driver.Value, error) {
+	return l.String(), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of lseg.
+func (l LineSegment) MarshalBinary() ([]byte, error) {
+	return appendFloats(nil, l[0].X, l[0].Y, l[1].X, l[1].Y), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (l *LineSegment) UnmarshalBinary(data []byte) error {
+	if err := checkBinaryLen(data, 32, "lseg"); err != nil {
+		return err
+	}
+	readFloats(data, &l[0].X, &l[0].Y, &l[1].X, &l[1].Y)
+	return nil
+}
+
+// String formats b as the server does, as in (3,4),(1,2).
+func (b Box) String() string {
+	s := appendPoint(nil, b[0])
+	s = append(s, ',')
+	return string(appendPoint(s, b[1]))
+}
+
+// Scan implements the Scanner interface.
+func (b *Box) Scan(value interface{}) error {
+	s, err := geomText(value, "Box")
+	if err != nil {
+		return err
+	}
+	p := geomParser{s: s}
+	p0 := p.point()
+	p.expect(',')
+	p1 := p.point()
+	if err := p.done("box"); err != nil {
+		return err
+	}
+	*b = Box{p0, p1}
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (b Box) Value() (driver.Value, error) {
+	return b.String(), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of box.
+func (b Box) MarshalBinary() ([]byte, error) {
+	return appendFloats(nil, b[0].X, b[0].Y, b[1].X, b[1].Y), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (b *Box) UnmarshalBinary(data []byte) error {
+	if err := checkBinaryLen(data, 32, "box"); err != nil {
+		return err
+	}
+	readFloats(data, &b[0].X, &b[0].Y, &b[1].X, &b[1].Y)
+	return nil
+}
+
+// String formats pa as the server does: [(1,2),(3,4)] if it is open,
+// ((1,2),(3,4)) if it is closed.
+func (pa Path) String() string {
+	if pa.Closed {
+		return string(appendPoints(nil, pa.Points, '(', ')'))
+	}
+	return string(appendPoints(nil, pa.Points, '[', ']'))
+}
+
+// Scan implements the Scanner interface.
+func (pa *Path) Scan(value interface{}) error {
+	if value == nil {
+		*pa = Path{}
+		return nil
+	}
+	s, err := geomText(value, "Path")
+	if err != nil {
+		return err
+	}
+
+	p := geomParser{s: s}
+	closed := p.peek() == '('
+	var pts []Point
+	if closed {
+		pts = p.points('(', ')')
+	} else {
+		pts = p.points('[', ']')
+	}
+	if err := p.done("path"); err != nil {
+		return err
+	}
+	*pa = Path{Points: pts, Closed: closed}
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (pa Path) Value() (driver.Value, error) {
+	if pa.Points == nil {
+		return nil, nil
+	}
+	return pa.String(), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of path: a closed flag, then the points.
+func (pa Path) MarshalBinary() ([]byte, error) {
+	closed := byte(0)
+	if pa.Closed {
+		closed = 1
+	}
+	return appendBinaryPoints([]byte{closed}, pa.Points), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (pa *Path) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("pq: invalid binary path")
+	}
+	pts, err := readBinaryPoints(data[1:], "path")
+	if err != nil {
+		return err
+	}
+	*pa = Path{Points: pts, Closed: data[0] != 0}
+	return nil
+}
+
+// String formats pg as the server does, as in ((1,2),(3,4),(5,6)).
+func (pg Polygon) String() string {
+	return string(appendPoints(nil, pg, '(', ')'))
+}
+
+// Scan implements the Scanner interface.
+func (pg *Polygon) Scan(value interface{}) error {
+	if value == nil {
+		*pg = nil
+		return nil
+	}
+	s, err := geomText(value, "Polygon")
+	if err != nil {
+		return err
+	}
+	p := geomParser{s: s}
+	pts := p.points('(', ')')
+	if err := p.done("polygon"); err != nil {
+		return err
+	}
+	*pg = pts
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (pg Polygon) Value() (driver.Value, error) {
+	if pg == nil {
+		return nil, nil
+	}
+	return pg.String(), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of polygon.
+func (pg Polygon) MarshalBinary() ([]byte, error) {
+	return appendBinaryPoints(nil, pg), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (pg *Polygon) UnmarshalBinary(data []byte) error {
+	pts, err := readBinaryPoints(data, "polygon")
+	if err != nil {
+		return err
+	}
+	*pg = pts
+	return nil
+}
+
+// String formats l as the server does, as in {1,-1,0}.
+func (l Line) String() string {
+	b := []byte{'{'}
+	b = appendGeomFloat(b, l.A)
+	b = append(b, ',')
+	b = appendGeomFloat(b, l.B)
+	b = append(b, ',')
+	b = appendGeomFloat(b, l.C)
+	return string(append(b, '}'))
+}
+
+// Scan implements the Scanner interface.
+func (l *Line) Scan(value interface{}) error {
+	s, err := geomText(value, "Line")
+	if err != nil {
+		return err
+	}
+	p := geomParser{s: s}
+	p.expect('{')
+	a := p.float()
+	p.expect(',')
+	b := p.float()
+	p.expect(',')
+	c := p.float()
+	p.expect('}')
+	if err := p.done("line"); err != nil {
+		return err
+	}
+	*l = Line{a, b, c}
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (l Line) Value() (driver.Value, error) {
+	return l.String(), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of line.
+func (l Line) MarshalBinary() ([]byte, error) {
+	return appendFloats(nil, l.A, l.B, l.C), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (l *Line) UnmarshalBinary(data []byte) error {
+	if err := checkBinaryLen(data, 24, "line"); err != nil {
+		return err
+	}
+	readFloats(data, &l.A, &l.B, &l.C)
+	return nil
+}
+
+// String formats c as the server does, as in <(1,2),3>.
+func (c Circle) String() string {
+	b := appendPoint([]byte{'<'}, c.Center)
+	b = append(b, ',')
+	b = appendGeomFloat(b, c.Radius)
+	return string(append(b, '>'))
+}
+
+// Scan implements the Scanner interface.
+func (c *Circle) Scan(value interface{}) error {
+	s, err := geomText(value, "Circle")
+	if err != nil {
+		return err
+	}
+	p := geomParser{s: s}
+	p.expect('<')
+	center := p.point()
+	p.expect(',')
+	r := p.float()
+	p.expect('>')
+	if err := p.done("circle"); err != nil {
+		return err
+	}
+	*c = Circle{center, r}
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (c Circle) Value() (driver.Value, error) {
+	return c.String(), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of circle.
+func (c Circle) MarshalBinary() ([]byte, error) {
+	return appendFloats(nil, c.Center.X, c.Center.Y, c.Radius), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (c *Circle) UnmarshalBinary(data []byte) error {
+	if err := checkBinaryLen(data, 24, "circle"); err != nil {
+		return err
+	}
+	readFloats(data, &c.Center.X, &c.Center.Y, &c.Radius)
+	return nil
+}
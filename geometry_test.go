@@ -0,0 +1,126 @@
+package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type geometry interface {
+	sql.Scanner
+	driver.Valuer
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+func TestGeometryText(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		dst  geometry
+		want geometry
+		out  string
+	}{
+		{"(1,2.5)", new(Point), &Point{1, 2.5}, "(1,2.5)"},
+		{" ( -1e+20 , Infinity ) ", new(Point), &Point{-1e20, math.Inf(1)}, "(-1e+20,Infinity)"},
+		{"[(1,2),(3,4)]", new(LineSegment), &LineSegment{{1, 2}, {3, 4}}, "[(1,2),(3,4)]"},
+		{"(3,4),(1,2)", new(Box), &Box{{3, 4}, {1, 2}}, "(3,4),(1,2)"},
+		{"[(1,2),(3,4),(5,6)]", new(Path), &Path{Points: []Point{{1, 2}, {3, 4}, {5, 6}}}, "[(1,2),(3,4),(5,6)]"},
+		{"((1,2),(3,4))", new(Path), &Path{Points: []Point{{1, 2}, {3, 4}}, Closed: true}, "((1,2),(3,4))"},
+		{"((0,0),(0,1),(1,0))", new(Polygon), &Polygon{{0, 0}, {0, 1}, {1, 0}}, "((0,0),(0,1),(1,0))"},
+		{"{1,-1,0}", new(Line), &Line{1, -1, 0}, "{1,-1,0}"},
+		{"<(1,2),3>", new(Circle), &Circle{Point{1, 2}, 3}, "<(1,2),3>"},
+	} {
+		if err := c.dst.Scan([]byte(c.in)); err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.dst, c.want) {
+			t.Errorf("%q: expected %v, got %v", c.in, c.want, c.dst)
+		}
+		if v, _ := c.dst.Value(); v != c.out {
+			t.Errorf("%q: expected %s, got %v", c.in, c.out, v)
+		}
+	}
+
+	for _, c := range []struct {
+		in  string
+		dst geometry
+	}{
+		{"(1,2", new(Point)},
+		{"(1,2,3)", new(Point)},
+		{"(1,2) x", new(Point)},
+		{"(a,2)", new(Point)},
+		{"[(1,2)]", new(LineSegment)},
+		{"(1,2)", new(Box)},
+		{"[(1,2),(3,4))", new(Path)},
+		{"{1,2}", new(Line)},
+		{"<(1,2)>", new(Circle)},
+	} {
+		if err := c.dst.Scan(c.in); err == nil {
+			t.Errorf("%q: expected error", c.in)
+		}
+	}
+}
+
+func TestGeometryBinary(t *testing.T) {
+	for _, c := range []struct {
+		in  geometry
+		out geometry
+		len int
+	}{
+		{&Point{1, 2}, new(Point), 16},
+		{&LineSegment{{1, 2}, {3, 4}}, new(LineSegment), 32},
+		{&Box{{3, 4}, {1, 2}}, new(Box), 32},
+		{&Path{Points: []Point{{1, 2}, {3, 4}}, Closed: true}, new(Path), 37},
+		{&Polygon{{0, 0}, {0, 1}, {1, 0}}, new(Polygon), 52},
+		{&Line{1, -1, 0}, new(Line), 24},
+		{&Circle{Point{1, 2}, 3}, new(Circle), 24},
+	} {
+		b, err := c.in.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != c.len {
+			t.Errorf("%v: expected %d bytes, got %d", c.in, c.len, len(b))
+		}
+		if err := c.out.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%v: %v", c.in, err)
+		}
+		if !reflect.DeepEqual(c.in, c.out) {
+			t.Errorf("expected %v, got %v", c.in, c.out)
+		}
+		if err := c.out.UnmarshalBinary(b[:len(b)-1]); err == nil {
+			t.Errorf("%v: expected error for truncated data", c.in)
+		}
+	}
+}
+
+func TestGeometryRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	for _, c := range []struct {
+		typ string
+		in  geometry
+		out geometry
+	}{
+		{"point", &Point{1.5, -2}, new(Point)},
+		{"lseg", &LineSegment{{1, 2}, {3, 4}}, new(LineSegment)},
+		{"box", &Box{{3, 4}, {1, 2}}, new(Box)},
+		{"path", &Path{Points: []Point{{1, 2}, {3, 4}}}, new(Path)},
+		{"path", &Path{Points: []Point{{1, 2}, {3, 4}, {5, 0}}, Closed: true}, new(Path)},
+		{"polygon", &Polygon{{0, 0}, {0, 1}, {1, 0}}, new(Polygon)},
+		{"line", &Line{1, -1, 0}, new(Line)},
+		{"circle", &Circle{Point{1, 2}, 3}, new(Circle)},
+	} {
+		if err := db.QueryRow("SELECT $1::"+c.typ, c.in).Scan(c.out); err != nil {
+			t.Fatalf("%s: %v", c.typ, err)
+		}
+		if !reflect.DeepEqual(c.in, c.out) {
+			t.Errorf("%s: expected %v, got %v", c.typ, c.in, c.out)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// The address families of the binary format of inet and cidr.
+const (
+	pgAFInet  = 2
+	pgAFInet6 = 3
+)
+
+// Inet is an inet or cidr value: an address with the length of its
+// netmask. As in inet, and unlike netip.Prefix.Masked, the bits of the
+// address beyond the netmask are kept. The zero Inet is NULL.
+//
+// Values of inet columns are returned as a net.IP for host addresses
+// and as a *net.IPNet otherwise; those of cidr columns always as a
+// *net.IPNet. Scan into an Inet to accept either.
+type Inet struct {
+	Prefix netip.Prefix
+}
+
+// ParseInet parses an address with an optional netmask length, such as
+// "192.168.0.1", "10.0.0.0/8" or "2001:db8::/32". Without a netmask the
+// address is a host address, with all of its bits.
+func ParseInet(s string) (Inet, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return Inet{Prefix: p}, nil
+	}
+
+	a, err := netip.ParseAddr(s)
+	if err != nil || a.Zone() != "" {
+		return Inet{}, fmt.Errorf("pq: invalid inet %q", s)
+	}
+	return Inet{Prefix: netip.PrefixFrom(a, a.BitLen())}, nil
+}
+
+// InetOf returns ip as a host address.
+func InetOf(ip net.IP) Inet {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	a, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return Inet{}
+	}
+	return Inet{Prefix: netip.PrefixFrom(a, a.BitLen())}
+}
+
+// String formats i as the server does for inet, leaving out the
+// netmask length of host addresses.
+func (i Inet) String() string {
+	if !i.Prefix.IsValid() {
+		return "NULL"
+	}
+	if i.Prefix.Bits() == i.Prefix.Addr().BitLen() {
+		return i.Prefix.Addr().String()
+	}
+	return i.Prefix.String()
+}
+
+// decoded returns i as decode does for a value of type typ.
+func (i Inet) decoded(typ oid) interface{} {
+	if typ == t_inet && i.Prefix.Bits() == i.Prefix.Addr().BitLen() {
+		return i.IP()
+	}
+	return i.IPNet()
+}
+
+// IP returns the address of i.
+func (i Inet) IP() net.IP {
+	if !i.Prefix.IsValid() {
+		return nil
+	}
+	return net.IP(i.Prefix.Addr().AsSlice())
+}
+
+// IPNet returns i as a *net.IPNet, with the address unmasked.
+func (i Inet) IPNet() *net.IPNet {
+	if !i.Prefix.IsValid() {
+		return nil
+	}
+	return &net.IPNet{
+		IP:   i.IP(),
+		Mask: net.CIDRMask(i.Prefix.Bits(), i.Prefix.Addr().BitLen()),
+	}
+}
+
+// Scan implements the Scanner interface. It accepts the text and the
+// binary format.
+func (i *Inet) Scan(value interface{}) (err error) {
+	switch v := value.(type) {
+	case nil:
+		*i = Inet{}
+	case []byte:
+		// Text starts with a digit, a hex digit or ':'; binary with
+		// the address family.
+		if len(v) > 0 && (v[0] == pgAFInet || v[0] == pgAFInet6) {
+			return i.UnmarshalBinary(v)
+		}
+		*i, err = ParseInet(string(v))
+	case string:
+		*i, err = ParseInet(v)
+	case net.IP:
+		if *i = InetOf(v); !i.Prefix.IsValid() && len(v) != 0 {
+			err = fmt.Errorf("pq: invalid IP address %v", v)
+		}
+	case *net.IPNet:
+		*i = Inet{}
+		if v != nil {
+			*i, err = ParseInet(v.String())
+		}
+	default:
+		err = fmt.Errorf("pq: cannot scan %T into Inet", value)
+	}
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (i Inet) Value() (driver.Value, error) {
+	if !i.Prefix.IsValid() {
+		return nil, nil
+	}
+	return i.String(), nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (i Inet) MarshalText() ([]byte, error) {
+	if !i.Prefix.IsValid() {
+		return []byte{}, nil
+	}
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (i *Inet) UnmarshalText(text []byte) (err error) {
+	if len(text) == 0 {
+		*i = Inet{}
+		return nil
+	}
+	*i, err = ParseInet(string(text))
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of inet and cidr: the address family, the netmask
+// length, a cidr flag the server ignores on input, and the address.
+func (i Inet) MarshalBinary() ([]byte, error) {
+	if !i.Prefix.IsValid() {
+		return nil, errors.New("pq: inet is NULL")
+	}
+
+	a := i.Prefix.Addr().AsSlice()
+	family := byte(pgAFInet)
+	if len(a) == 16 {
+		family = pgAFInet6
+	}
+	return append([]byte{family, byte(i.Prefix.Bits()), 0, byte(len(a))}, a...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (i *Inet) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 || int(data[3]) != len(data)-4 {
+		return errors.New("pq: invalid binary inet")
+	}
+
+	family, bits, addr := data[0], int(data[1]), data[4:]
+	if (family != pgAFInet || len(addr) != 4) && (family != pgAFInet6 || len(addr) != 16) {
+		return errors.New("pq: invalid binary inet")
+	}
+
+	a, _ := netip.AddrFromSlice(addr)
+	p := netip.PrefixFrom(a, bits)
+	if !p.IsValid() {
+		return fmt.Errorf("pq: invalid netmask length %d in binary inet", bits)
+	}
+	*i = Inet{Prefix: p}
+	return nil
+}
+
+// MACAddr is a macaddr or macaddr8 value. The empty MACAddr is NULL.
+// Values of macaddr and macaddr8 columns are returned as a
+// net.HardwareAddr, which can be scanned into a MACAddr too.
+type MACAddr net.HardwareAddr
+
+// ParseMACAddr parses a MAC address in any of the forms of
+// net.ParseMAC, which include the output of macaddr and macaddr8.
+func ParseMACAddr(s string) (MACAddr, error) {
+	hw, err := net.ParseMAC(s)
+	if err != nil || (len(hw) != 6 && len(hw) != 8) {
+		return nil, fmt.Errorf("pq: invalid MAC address %q", s)
+	}
+	return MACAddr(hw), nil
+}
+
+// String formats m with colons, as the server does.
+func (m MACAddr) String() string {
+	return net.HardwareAddr(m).String()
+}
+
+// Scan implements the Scanner interface. It accepts the text and the
+// binary format.
+func (m *MACAddr) Scan(value interface{}) (err error) {
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+	case []byte:
+		// The text format is at least 12 bytes long; the binary one
+		// is the 6 or 8 bytes of the address.
+		if len(v) == 6 || len(v) == 8 {
+			return m.UnmarshalBinary(v)
+		}
+		*m, err = ParseMACAddr(string(v))
+	case string:
+		*m, err = ParseMACAddr(v)
+	case net.HardwareAddr:
+		if len(v) == 0 {
+			*m = nil
+			break
+		}
+		err = m.UnmarshalBinary(v)
+	default:
+		err = fmt.Errorf("pq: cannot scan %T into MACAddr", value)
+	}
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (m MACAddr) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return m.String(), nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m MACAddr) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *MACAddr) UnmarshalText(text []byte) (err error) {
+	if len(text) == 0 {
+		*m = nil
+		return nil
+	}
+	*m, err = ParseMACAddr(string(text))
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The binary wire
+// format of macaddr and macaddr8 is the bytes of the address.
+func (m MACAddr) MarshalBinary() ([]byte, error) {
+	if len(m) != 6 && len(m) != 8 {
+		return nil, fmt.Errorf("pq: invalid MAC address length %d", len(m))
+	}
+	return append([]byte(nil), m...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *MACAddr) UnmarshalBinary(data []byte) error {
+	if len(data) != 6 && len(data) != 8 {
+		return fmt.Errorf("pq: invalid binary MAC address of length %d", len(data))
+	}
+	*m = append(MACAddr(nil), data...)
+	return nil
+}
+
+// InetArray is an inet[] or cidr[] value. NULL elements are the zero
+// Inet.
+type InetArray []Inet
+
+// Scan implements the Scanner interface.
+func (a *InetArray) Scan(value interface{}) error {
+	src, ok := value.([]byte)
+	if !ok {
+		if value == nil {
+			*a = nil
+			return nil
+		}
+		return fmt.Errorf("pq: cannot scan %T into InetArray", value)
+	}
+
+	elems, err := parseArray(src, ',')
+	if err != nil {
+		return err
+	}
+
+	b := make(InetArray, len(elems))
+	for i, e := range elems {
+		if e == nil {
+			continue
+		}
+		if b[i], err = ParseInet(string(e)); err != nil {
+			return err
+		}
+	}
+	*a = b
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (a InetArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	elems := make([][]byte, len(a))
+	for i, e := range a {
+		if e.Prefix.IsValid() {
+			elems[i] = []byte(e.String())
+		}
+	}
+	return string(appendArray(nil, elems, ',')), nil
+}
+
+// MACAddrArray is a macaddr[] or macaddr8[] value. NULL elements are
+// nil.
+type MACAddrArray []net.HardwareAddr
+
+// Scan implements the Scanner interface.
+func (a *MACAddrArray) Scan(value interface{}) error {
+	src, ok := value.([]byte)
+	if !ok {
+		if value == nil {
+			*a = nil
+			return nil
+		}
+		return fmt.Errorf("pq: cannot scan %T into MACAddrArray", value)
+	}
+
+	elems, err := parseArray(src, ',')
+	if err != nil {
+		return err
+	}
+
+	b := make(MACAddrArray, len(elems))
+	for i, e := range elems {
+		if e == nil {
+			continue
+		}
+		m, err := ParseMACAddr(string(e))
+		if err != nil {
+			return err
+		}
+		b[i] = net.HardwareAddr(m)
+	}
+	*a = b
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (a MACAddrArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	elems := make([][]byte, len(a))
+	for i, e := range a {
+		if e != nil {
+			elems[i] = []byte(e.String())
+		}
+	}
+	return string(appendArray(nil, elems, ',')), nil
+}
+
+// decodeInet decodes the text of an inet or cidr value.
+func decodeInet(s []byte, typ oid) interface{} {
+	i, err := ParseInet(string(s))
+	if err != nil {
+		errorf("invalid %s %q", typeNames[typ], s)
+	}
+	return i.decoded(typ)
+}
+
+// decodeMACAddr decodes the text of a macaddr or macaddr8 value.
+func decodeMACAddr(s []byte) interface{} {
+	m, err := ParseMACAddr(string(s))
+	if err != nil {
+		errorf("invalid MAC address %q", s)
+	}
+	return net.HardwareAddr(m)
+}
+
+// netValue returns v, one of the network address types encode accepts,
+// or nil if v is empty, so that it is sent as NULL.
+func netValue(v interface{}) driver.Value {
+	switch v := v.(type) {
+	case net.IP:
+		if len(v) == 0 {
+			return nil
+		}
+	case net.HardwareAddr:
+		if len(v) == 0 {
+			return nil
+		}
+	case *net.IPNet:
+		if v == nil {
+			return nil
+		}
+	case netip.Addr:
+		if !v.IsValid() {
+			return nil
+		}
+	case netip.Prefix:
+		if !v.IsValid() {
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,215 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParseInet(t *testing.T) {
+	for s, want := range map[string]string{
+		"192.168.0.1":     "192.168.0.1",
+		"192.168.0.1/32":  "192.168.0.1",
+		"10.1.2.3/8":      "10.1.2.3/8",
+		"10.0.0.0/8":      "10.0.0.0/8",
+		"2001:db8::/32":   "2001:db8::/32",
+		"::1":             "::1",
+		"::ffff:1.2.3.4":  "::ffff:1.2.3.4",
+		"fe80::1/64":      "fe80::1/64",
+		"2001:db8::1/128": "2001:db8::1",
+	} {
+		i, err := ParseInet(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if got := i.String(); got != want {
+			t.Errorf("%s: expected %s, got %s", s, want, got)
+		}
+
+		b, _ := i.MarshalBinary()
+		var back Inet
+		if err := back.Scan(b); err != nil || back != i {
+			t.Errorf("%s: binary round trip gave %v, %v", s, back, err)
+		}
+	}
+
+	for _, s := range []string{"", "1.2.3", "10.0.0.0/33", "fe80::1%eth0", "host"} {
+		if _, err := ParseInet(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestInetConversions(t *testing.T) {
+	i, _ := ParseInet("10.1.2.3/8")
+	if got := i.IP(); !got.Equal(net.IPv4(10, 1, 2, 3)) {
+		t.Errorf("unexpected IP %v", got)
+	}
+	if got := i.IPNet().String(); got != "10.1.2.3/8" {
+		t.Errorf("unexpected IPNet %v", got)
+	}
+
+	if got := InetOf(net.ParseIP("192.168.0.1")); got.String() != "192.168.0.1" || !got.Prefix.Addr().Is4() {
+		t.Errorf("unexpected %v", got)
+	}
+
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+	for _, v := range []interface{}{net.ParseIP("10.0.0.1"), ipnet, i.IPNet()} {
+		var got Inet
+		if err := got.Scan(v); err != nil {
+			t.Errorf("%v: %v", v, err)
+		} else if got.String() != fmt.Sprint(v) {
+			t.Errorf("%v: scanned %v", v, got)
+		}
+	}
+
+	var null Inet
+	if err := null.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := null.Value(); v != nil {
+		t.Errorf("expected NULL, got %v", v)
+	}
+	if null.IP() != nil || null.IPNet() != nil {
+		t.Error("expected nil IP and IPNet for NULL")
+	}
+}
+
+func TestMACAddr(t *testing.T) {
+	for s, want := range map[string]string{
+		"08:00:2b:01:02:03":       "08:00:2b:01:02:03",
+		"08-00-2B-01-02-03":       "08:00:2b:01:02:03",
+		"0800.2b01.0203":          "08:00:2b:01:02:03",
+		"08:00:2b:01:02:03:04:05": "08:00:2b:01:02:03:04:05",
+	} {
+		var m MACAddr
+		if err := m.Scan([]byte(s)); err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if m.String() != want {
+			t.Errorf("%s: expected %s, got %s", s, want, m)
+		}
+
+		b, _ := m.MarshalBinary()
+		var back MACAddr
+		if err := back.Scan(b); err != nil || !reflect.DeepEqual(back, m) {
+			t.Errorf("%s: binary round trip gave %v, %v", s, back, err)
+		}
+	}
+
+	var m MACAddr
+	hw, _ := net.ParseMAC("08:00:2b:01:02:03")
+	if err := m.Scan(hw); err != nil || m.String() != hw.String() {
+		t.Errorf("scanning %v gave %v, %v", hw, m, err)
+	}
+	if err := m.Scan("00:00:5e:00:53:00:00:00:00:00:00:00:00:00:00:00:00:00:00:01"); err == nil {
+		t.Error("expected error for 20 byte address")
+	}
+}
+
+func TestNetArrays(t *testing.T) {
+	var ia InetArray
+	if err := ia.Scan([]byte(`{10.0.0.1,NULL,10.0.0.0/8}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(ia) != 3 || ia[0].String() != "10.0.0.1" || ia[1].Prefix.IsValid() || ia[2].String() != "10.0.0.0/8" {
+		t.Errorf("unexpected %v", ia)
+	}
+	if v, _ := ia.Value(); v != `{"10.0.0.1",NULL,"10.0.0.0/8"}` {
+		t.Errorf("unexpected %v", v)
+	}
+
+	var ma MACAddrArray
+	if err := ma.Scan([]byte(`{08:00:2b:01:02:03,NULL}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(ma) != 2 || ma[0].String() != "08:00:2b:01:02:03" || ma[1] != nil {
+		t.Errorf("unexpected %v", ma)
+	}
+	if v, _ := ma.Value(); v != `{"08:00:2b:01:02:03",NULL}` {
+		t.Errorf("unexpected %v", v)
+	}
+}
+
+func TestEncodeNet(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+	mac, _ := net.ParseMAC("08:00:2b:01:02:03")
+	for _, c := range []struct {
+		in   interface{}
+		typ  oid
+		want string
+	}{
+		{net.ParseIP("192.168.0.1"), t_inet, "192.168.0.1"},
+		{net.IPv4(1, 2, 3, 4).To4(), t_bytea, `\x01020304`},
+		{ipnet, t_cidr, "10.0.0.0/8"},
+		{mac, t_macaddr, "08:00:2b:01:02:03"},
+		{netip.MustParseAddr("::1"), t_inet, "::1"},
+		{netip.MustParsePrefix("10.1.2.3/8"), t_inet, "10.1.2.3/8"},
+	} {
+		if got := string(encode(c.in, c.typ)); got != c.want {
+			t.Errorf("%v: expected %s, got %s", c.in, c.want, got)
+		}
+	}
+
+	for _, v := range []interface{}{net.IP(nil), (*net.IPNet)(nil), netip.Addr{}, netip.Prefix{}} {
+		nv := driver.NamedValue{Value: v}
+		if err := (&conn{}).CheckNamedValue(&nv); err != nil || nv.Value != nil {
+			t.Errorf("%#v: expected NULL, got %#v, %v", v, nv.Value, err)
+		}
+	}
+}
+
+func TestNetRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	var i Inet
+	if err := db.QueryRow("SELECT $1::inet", net.ParseIP("2001:db8::1")).Scan(&i); err != nil {
+		t.Fatal(err)
+	}
+	if i.String() != "2001:db8::1" {
+		t.Errorf("unexpected %v", i)
+	}
+
+	var ip net.IP
+	var ipnet *net.IPNet
+	if err := db.QueryRow("SELECT '10.0.0.1'::inet, '10.0.0.0/8'::cidr").Scan(&ip, &ipnet); err != nil {
+		t.Fatal(err)
+	}
+	if ip.String() != "10.0.0.1" || ipnet.String() != "10.0.0.0/8" {
+		t.Errorf("unexpected %v, %v", ip, ipnet)
+	}
+
+	var s string
+	if err := db.QueryRow("SELECT $1::cidr::text", netip.MustParsePrefix("10.0.0.0/8")).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "10.0.0.0/8" {
+		t.Errorf("unexpected %s", s)
+	}
+
+	for _, typ := range []string{"macaddr", "macaddr8"} {
+		var m MACAddr
+		var hw net.HardwareAddr
+		in, _ := net.ParseMAC("08:00:2b:01:02:03")
+		if err := db.QueryRow("SELECT $1::"+typ+", $1::"+typ, in).Scan(&m, &hw); err != nil {
+			t.Fatal(err)
+		}
+		if len(m) == 0 || m.String() != hw.String() {
+			t.Errorf("%s: unexpected %v, %v", typ, m, hw)
+		}
+	}
+
+	var ia InetArray
+	if err := db.QueryRow("SELECT $1::inet[]", InetArray{i, {}}).Scan(&ia); err != nil {
+		t.Fatal(err)
+	}
+	if len(ia) != 2 || ia[0] != i || ia[1].Prefix.IsValid() {
+		t.Errorf("unexpected %v", ia)
+	}
+}
@@ -0,0 +1,421 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval is an interval value. Its three fields are kept apart, as
+// the server keeps them, because a month is not a fixed number of days
+// and, across daylight saving changes, a day not a fixed number of
+// hours.
+type Interval struct {
+	Months       int32
+	Days         int32
+	Microseconds int64
+}
+
+const (
+	usecPerSec  = 1000000
+	usecPerMin  = 60 * usecPerSec
+	usecPerHour = 60 * usecPerMin
+	usecPerDay  = 24 * usecPerHour
+)
+
+// intervalUnit tells which field a unit of an interval adds to, and how
+// many of that field's units it counts for.
+type intervalUnit struct {
+	field  byte // 'M' months, 'D' days or 'U' microseconds
+	factor int64
+}
+
+var intervalUnits = map[string]intervalUnit{
+	"millennium": {'M', 12000}, "millennia": {'M', 12000}, "mil": {'M', 12000}, "mils": {'M', 12000},
+	"century": {'M', 1200}, "centuries": {'M', 1200}, "cent": {'M', 1200}, "cents": {'M', 1200},
+	"decade": {'M', 120}, "decades": {'M', 120}, "dec": {'M', 120}, "decs": {'M', 120},
+	"year": {'M', 12}, "years": {'M', 12}, "yr": {'M', 12}, "yrs": {'M', 12}, "y": {'M', 12},
+	"month": {'M', 1}, "months": {'M', 1}, "mon": {'M', 1}, "mons": {'M', 1},
+	"week": {'D', 7}, "weeks": {'D', 7}, "w": {'D', 7},
+	"day": {'D', 1}, "days": {'D', 1}, "d": {'D', 1},
+	"hour": {'U', usecPerHour}, "hours": {'U', usecPerHour}, "hr": {'U', usecPerHour}, "hrs": {'U', usecPerHour}, "h": {'U', usecPerHour},
+	"minute": {'U', usecPerMin}, "minutes": {'U', usecPerMin}, "min": {'U', usecPerMin}, "mins": {'U', usecPerMin}, "m": {'U', usecPerMin},
+	"second": {'U', usecPerSec}, "seconds": {'U', usecPerSec}, "sec": {'U', usecPerSec}, "secs": {'U', usecPerSec}, "s": {'U', usecPerSec},
+	"millisecond": {'U', 1000}, "milliseconds": {'U', 1000}, "msec": {'U', 1000}, "msecs": {'U', 1000}, "ms": {'U', 1000},
+	"microsecond": {'U', 1}, "microseconds": {'U', 1}, "usec": {'U', 1}, "usecs": {'U', 1}, "us": {'U', 1},
+}
+
+// ParseInterval parses an interval in any of the output formats of the
+// IntervalStyle setting:
+//
+//	postgres           1 year 2 mons 3 days 04:05:06.789
+//	postgres_verbose   @ 1 year 2 mons 3 days 4 hours 5 mins 6.789 secs ago
+//	sql_standard       1-2 3 4:05:06.789
+//	iso_8601           P1Y2M3DT4H5M6.789S
+//
+// as well as most of the other input forms the server accepts. Parts of
+// a unit are carried down to the smaller fields as the server does:
+// half a month is 15 days, half a day 12 hours.
+func ParseInterval(s string) (Interval, error) {
+	var (
+		a   intervalAcc
+		err error
+	)
+	if strings.HasPrefix(s, "P") || strings.HasPrefix(s, "-P") {
+		err = a.parseISO(s)
+	} else {
+		err = a.parseFields(s)
+	}
+	if err != nil {
+		return Interval{}, fmt.Errorf("pq: invalid interval %q: %v", s, err)
+	}
+	return a.interval()
+}
+
+// intervalAcc accumulates the fields of an interval while it is parsed,
+// with room for sums beyond the range of Interval.
+type intervalAcc struct {
+	months, days, usecs *big.Rat
+}
+
+func (a *intervalAcc) add(v *big.Rat, field byte, factor int64) {
+	if a.months == nil {
+		a.months, a.days, a.usecs = new(big.Rat), new(big.Rat), new(big.Rat)
+	}
+
+	v = new(big.Rat).Mul(v, big.NewRat(factor, 1))
+	switch field {
+	case 'M':
+		a.months.Add(a.months, v)
+	case 'D':
+		a.days.Add(a.days, v)
+	default:
+		a.usecs.Add(a.usecs, v)
+	}
+}
+
+func (a *intervalAcc) interval() (Interval, error) {
+	if a.months == nil {
+		return Interval{}, nil
+	}
+
+	// Carry fractions down, counting a month as 30 days.
+	months := truncRat(a.months)
+	days := new(big.Rat).Sub(a.months, new(big.Rat).SetInt(months))
+	days.Mul(days, big.NewRat(30, 1))
+	days.Add(days, a.days)
+
+	d := truncRat(days)
+	usecs := new(big.Rat).Sub(days, new(big.Rat).SetInt(d))
+	usecs.Mul(usecs, big.NewRat(usecPerDay, 1))
+	usecs.Add(usecs, a.usecs)
+	u := roundRat(usecs)
+
+	if !months.IsInt64() || months.Int64() < math.MinInt32 || months.Int64() > math.MaxInt32 ||
+		!d.IsInt64() || d.Int64() < math.MinInt32 || d.Int64() > math.MaxInt32 || !u.IsInt64() {
+		return Interval{}, errors.New("pq: interval out of range")
+	}
+	return Interval{Months: int32(months.Int64()), Days: int32(d.Int64()), Microseconds: u.Int64()}, nil
+}
+
+// parseISO parses the ISO 8601 format with designators.
+func (a *intervalAcc) parseISO(s string) error {
+	neg := false
+	if s[0] == '-' {
+		neg, s = true, s[1:]
+	}
+	s = s[1:]
+	if s == "" {
+		return errors.New("empty ISO 8601 interval")
+	}
+
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			if inTime {
+				return errors.New("repeated T")
+			}
+			inTime, s = true, s[1:]
+			continue
+		}
+
+		i := strings.IndexAny(s, "YMWDHS")
+		if i < 0 {
+			return fmt.Errorf("missing designator after %q", s)
+		}
+		v, ok := parseRat(s[:i])
+		if !ok {
+			return fmt.Errorf("invalid number %q", s[:i])
+		}
+		if neg {
+			v.Neg(v)
+		}
+
+		unit := s[i]
+		s = s[i+1:]
+		switch {
+		case unit == 'M' && !inTime:
+			a.add(v, 'M', 1)
+		case unit == 'Y' && !inTime:
+			a.add(v, 'M', 12)
+		case unit == 'W' && !inTime:
+			a.add(v, 'D', 7)
+		case unit == 'D' && !inTime:
+			a.add(v, 'D', 1)
+		case unit == 'H' && inTime:
+			a.add(v, 'U', usecPerHour)
+		case unit == 'M' && inTime:
+			a.add(v, 'U', usecPerMin)
+		case unit == 'S' && inTime:
+			a.add(v, 'U', usecPerSec)
+		default:
+			return fmt.Errorf("misplaced designator %c", unit)
+		}
+	}
+	return nil
+}
+
+// parseFields parses the postgres, postgres_verbose and sql_standard
+// formats, which are all runs of space separated fields.
+func (a *intervalAcc) parseFields(s string) error {
+	f := strings.Fields(strings.ToLower(s))
+	if len(f) > 0 && f[0] == "@" {
+		f = f[1:]
+	}
+	ago := false
+	if len(f) > 0 && f[len(f)-1] == "ago" {
+		ago, f = true, f[:len(f)-1]
+	}
+	if len(f) == 0 {
+		return errors.New("no fields")
+	}
+
+	// In sql_standard output a leading minus sign applies to all the
+	// fields without a sign of their own, as in "-1 2:03:04". Fields
+	// with units, as in the postgres format, have their own sign.
+	sign := int64(1)
+	if f[0][0] == '-' && (len(f) == 1 || intervalUnits[f[1]].field == 0) {
+		sign = -1
+	}
+	if ago {
+		sign = -sign
+	}
+
+	for i := 0; i < len(f); i++ {
+		tok := f[i]
+		s := sign
+		if tok[0] == '+' || tok[0] == '-' {
+			s = 1
+			if ago {
+				s = -1
+			}
+		}
+
+		var err error
+		switch {
+		case strings.Contains(tok, ":"):
+			err = a.parseTime(tok, s)
+		case strings.LastIndexByte(tok, '-') > 0:
+			err = a.parseYearMonth(tok, s)
+		default:
+			unit := intervalUnit{'D', 1} // a number without a unit counts days
+			if i+1 < len(f) {
+				if u, ok := intervalUnits[f[i+1]]; ok {
+					unit = u
+					i++
+				}
+			}
+			v, ok := parseRat(tok)
+			if !ok {
+				return fmt.Errorf("invalid field %q", tok)
+			}
+			a.add(v.Mul(v, big.NewRat(s, 1)), unit.field, unit.factor)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTime parses a [-]h:mm[:ss[.ffffff]] field.
+func (a *intervalAcc) parseTime(tok string, sign int64) error {
+	if tok[0] == '-' {
+		sign = -sign
+	}
+	parts := strings.Split(strings.TrimLeft(tok, "+-"), ":")
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid time %q", tok)
+	}
+
+	factors := []int64{usecPerHour, usecPerMin, usecPerSec}
+	for i, p := range parts {
+		v, ok := parseRat(p)
+		if !ok || p[0] == '+' || p[0] == '-' || (i < len(parts)-1 && !v.IsInt()) {
+			return fmt.Errorf("invalid time %q", tok)
+		}
+		a.add(v.Mul(v, big.NewRat(sign, 1)), 'U', factors[i])
+	}
+	return nil
+}
+
+// parseYearMonth parses the [-]y-m field of sql_standard.
+func (a *intervalAcc) parseYearMonth(tok string, sign int64) error {
+	if tok[0] == '-' {
+		sign = -sign
+	}
+	y, m, _ := strings.Cut(strings.TrimLeft(tok, "+-"), "-")
+	yv, err1 := strconv.ParseInt(y, 10, 32)
+	mv, err2 := strconv.ParseInt(m, 10, 32)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("invalid year-month %q", tok)
+	}
+	a.add(big.NewRat(sign*(yv*12+mv), 1), 'M', 1)
+	return nil
+}
+
+// parseRat parses a decimal number with an optional sign.
+func parseRat(s string) (*big.Rat, bool) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 || digits == "" || digits == "." ||
+		strings.Trim(digits, "0123456789.") != "" || strings.Count(digits, ".") > 1 {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+func truncRat(r *big.Rat) *big.Int {
+	return new(big.Int).Quo(r.Num(), r.Denom())
+}
+
+// roundRat rounds r to the nearest integer, halves away from zero.
+func roundRat(r *big.Rat) *big.Int {
+	n := new(big.Int).Abs(r.Num())
+	n.Lsh(n, 1).Add(n, r.Denom())
+	n.Quo(n, new(big.Int).Lsh(r.Denom(), 1))
+	if r.Sign() < 0 {
+		n.Neg(n)
+	}
+	return n
+}
+
+// String formats iv in the ISO 8601 format, as with the iso_8601
+// IntervalStyle. The server reads it back whatever its IntervalStyle.
+func (iv Interval) String() string {
+	if iv == (Interval{}) {
+		return "PT0S"
+	}
+
+	b := []byte{'P'}
+	if y := iv.Months / 12; y != 0 {
+		b = strconv.AppendInt(b, int64(y), 10)
+		b = append(b, 'Y')
+	}
+	if m := iv.Months % 12; m != 0 {
+		b = strconv.AppendInt(b, int64(m), 10)
+		b = append(b, 'M')
+	}
+	if iv.Days != 0 {
+		b = strconv.AppendInt(b, int64(iv.Days), 10)
+		b = append(b, 'D')
+	}
+
+	if u := iv.Microseconds; u != 0 {
+		b = append(b, 'T')
+		if h := u / usecPerHour; h != 0 {
+			b = strconv.AppendInt(b, h, 10)
+			b = append(b, 'H')
+		}
+		if m := u / usecPerMin % 60; m != 0 {
+			b = strconv.AppendInt(b, m, 10)
+			b = append(b, 'M')
+		}
+		if s := u % usecPerMin; s != 0 {
+			if s < 0 {
+				b = append(b, '-')
+				s = -s
+			}
+			b = strconv.AppendInt(b, s/usecPerSec, 10)
+			if f := s % usecPerSec; f != 0 {
+				frac := strconv.FormatInt(usecPerSec+f, 10)[1:]
+				b = append(b, '.')
+				b = append(b, strings.TrimRight(frac, "0")...)
+			}
+			b = append(b, 'S')
+		}
+	}
+	return string(b)
+}
+
+// Duration returns iv as a time.Duration. It fails if iv has months or
+// days, whose length varies, or does not fit.
+func (iv Interval) Duration() (time.Duration, error) {
+	if iv.Months != 0 || iv.Days != 0 {
+		return 0, errors.New("pq: interval with months or days has no fixed duration")
+	}
+	if iv.Microseconds > math.MaxInt64/1000 || iv.Microseconds < math.MinInt64/1000 {
+		return 0, errors.New("pq: interval out of range for time.Duration")
+	}
+	return time.Duration(iv.Microseconds) * time.Microsecond, nil
+}
+
+// IntervalOf returns d as an Interval, rounded to microseconds.
+func IntervalOf(d time.Duration) Interval {
+	return Interval{Microseconds: int64(d.Round(time.Microsecond) / time.Microsecond)}
+}
+
+// Scan implements the Scanner interface.
+func (iv *Interval) Scan(value interface{}) (err error) {
+	switch v := value.(type) {
+	case []byte:
+		*iv, err = ParseInterval(string(v))
+	case string:
+		*iv, err = ParseInterval(v)
+	default:
+		err = fmt.Errorf("pq: cannot scan %T into Interval", value)
+	}
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (iv Interval) Value() (driver.Value, error) {
+	return iv.String(), nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (iv Interval) MarshalText() ([]byte, error) {
+	return []byte(iv.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (iv *Interval) UnmarshalText(text []byte) (err error) {
+	*iv, err = ParseInterval(string(text))
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of interval: microseconds, days, then months.
+func (iv Interval) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, uint64(iv.Microseconds))
+	binary.BigEndian.PutUint32(b[8:], uint32(iv.Days))
+	binary.BigEndian.PutUint32(b[12:], uint32(iv.Months))
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (iv *Interval) UnmarshalBinary(data []byte) error {
+	if len(data) != 16 {
+		return fmt.Errorf("pq: invalid binary interval of length %d", len(data))
+	}
+	iv.Microseconds = int64(binary.BigEndian.Uint64(data))
+	iv.Days = int32(binary.BigEndian.Uint32(data[8:]))
+	iv.Months = int32(binary.BigEndian.Uint32(data[12:]))
+	return nil
+}
@@ -0,0 +1,165 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	full := Interval{Months: 14, Days: 3, Microseconds: 4*usecPerHour + 5*usecPerMin + 6789000}
+	mixed := Interval{Months: -14, Days: 3, Microseconds: -(4*usecPerHour + 5*usecPerMin + 6789000)}
+
+	for _, c := range []struct {
+		in   string
+		want Interval
+	}{
+		// postgres
+		{"1 year 2 mons 3 days 04:05:06.789", full},
+		{"-1 years -2 mons +3 days -04:05:06.789", mixed},
+		{"00:00:00", Interval{}},
+		{"-00:00:01", Interval{Microseconds: -usecPerSec}},
+		{"1 day", Interval{Days: 1}},
+		// postgres_verbose
+		{"@ 1 year 2 mons 3 days 4 hours 5 mins 6.789 secs", full},
+		{"@ 1 year 2 mons -3 days 4 hours 5 mins 6.789 secs ago", mixed},
+		{"@ 0", Interval{}},
+		// sql_standard
+		{"1-2 3 4:05:06.789", full},
+		{"-1-2 +3 -4:05:06.789", mixed},
+		{"-1-2", Interval{Months: -14}},
+		{"-3 4:05:06", Interval{Days: -3, Microseconds: -(4*usecPerHour + 5*usecPerMin + 6*usecPerSec)}},
+		{"0", Interval{}},
+		// iso_8601
+		{"P1Y2M3DT4H5M6.789S", full},
+		{"P-1Y-2M3DT-4H-5M-6.789S", mixed},
+		{"PT0S", Interval{}},
+		{"P1W", Interval{Days: 7}},
+		// other input forms
+		{"1.5 months", Interval{Months: 1, Days: 15}},
+		{"0.5 days", Interval{Microseconds: 12 * usecPerHour}},
+		{"2 weeks 1 ms", Interval{Days: 14, Microseconds: 1000}},
+		{"1:30", Interval{Microseconds: 90 * usecPerMin}},
+		{"0.0000005 secs", Interval{Microseconds: 1}},
+	} {
+		got, err := ParseInterval(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q: expected %+v, got %+v", c.in, c.want, got)
+		}
+	}
+
+	for _, s := range []string{"", "@", "1 fortnight", "P", "P1X", "PT1D", "1:2:3:4", "1.5:00", "abc", "9999999999 years"} {
+		if _, err := ParseInterval(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestIntervalString(t *testing.T) {
+	for _, c := range []struct {
+		in   Interval
+		want string
+	}{
+		{Interval{}, "PT0S"},
+		{Interval{Months: 14, Days: 3, Microseconds: 4*usecPerHour + 5*usecPerMin + 6789000}, "P1Y2M3DT4H5M6.789S"},
+		{Interval{Months: -14, Days: 3, Microseconds: -(4*usecPerHour + 5*usecPerMin + 6789000)}, "P-1Y-2M3DT-4H-5M-6.789S"},
+		{Interval{Microseconds: 1}, "PT0.000001S"},
+		{Interval{Microseconds: -500000}, "PT-0.5S"},
+		{Interval{Days: 1}, "P1D"},
+	} {
+		if got := c.in.String(); got != c.want {
+			t.Errorf("%+v: expected %s, got %s", c.in, c.want, got)
+		}
+		back, err := ParseInterval(c.want)
+		if err != nil || back != c.in {
+			t.Errorf("%s: parsed back to %+v, %v", c.want, back, err)
+		}
+	}
+}
+
+func TestIntervalDuration(t *testing.T) {
+	d, err := Interval{Microseconds: 1500}.Duration()
+	if err != nil || d != 1500*time.Microsecond {
+		t.Errorf("unexpected %v, %v", d, err)
+	}
+
+	for _, iv := range []Interval{{Days: 1}, {Months: 1}, {Microseconds: 1 << 62}} {
+		if _, err := iv.Duration(); err == nil {
+			t.Errorf("%+v: expected error", iv)
+		}
+	}
+
+	if got := IntervalOf(1500 * time.Nanosecond); got != (Interval{Microseconds: 2}) {
+		t.Errorf("unexpected %+v", got)
+	}
+}
+
+func TestIntervalBinary(t *testing.T) {
+	iv := Interval{Months: -14, Days: 3, Microseconds: -123456789}
+	b, _ := iv.MarshalBinary()
+	var got Interval
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got != iv {
+		t.Errorf("expected %+v, got %+v", iv, got)
+	}
+	if err := got.UnmarshalBinary(b[1:]); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestEncodeInterval(t *testing.T) {
+	if got := string(encode(time.Duration(90*time.Second), t_interval)); got != "PT1M30S" {
+		t.Errorf("unexpected %s", got)
+	}
+	if got := string(encode(time.Duration(90), t_int8)); got != "90" {
+		t.Errorf("unexpected %s", got)
+	}
+	if got := string(encode(Interval{Days: 2}, t_interval)); got != "P2D" {
+		t.Errorf("unexpected %s", got)
+	}
+
+	nv := driver.NamedValue{Value: time.Second}
+	if err := (&conn{}).CheckNamedValue(&nv); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntervalRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	want := Interval{Months: -14, Days: 3, Microseconds: -(4*usecPerHour + 5*usecPerMin + 6789000)}
+	for _, style := range []string{"postgres", "postgres_verbose", "sql_standard", "iso_8601"} {
+		if _, err := tx.Exec("SET LOCAL IntervalStyle = " + style); err != nil {
+			t.Fatal(err)
+		}
+
+		var got Interval
+		if err := tx.QueryRow("SELECT $1::interval", want).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", style, want, got)
+		}
+	}
+
+	var s string
+	if err := tx.QueryRow("SELECT $1::interval::text", 90*time.Minute).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "PT1H30M" {
+		t.Errorf("unexpected %s", s)
+	}
+}
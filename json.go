@@ -0,0 +1,123 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// jsonbVersion is the version byte that starts the binary format of
+// jsonb; the rest is the text of the document.
+const jsonbVersion = 1
+
+// JSON passes any value as a json or jsonb parameter, encoding it with
+// encoding/json, and scans json and jsonb columns into any value V
+// points to:
+//
+//	err := db.QueryRow("SELECT doc FROM t").Scan(pq.JSON{&v})
+//
+// Scanning NULL decodes JSON null, which sets pointers, maps, slices
+// and interfaces to nil and leaves other values unchanged.
+type JSON struct {
+	V interface{}
+}
+
+// Scan implements the Scanner interface.
+func (j JSON) Scan(value interface{}) error {
+	var src []byte
+	switch v := value.(type) {
+	case nil:
+		src = []byte("null")
+	case []byte:
+		src = v
+	case string:
+		src = []byte(v)
+	default:
+		return fmt.Errorf("pq: cannot scan %T into JSON", value)
+	}
+
+	return json.Unmarshal(src, j.V)
+}
+
+// Value implements the driver Valuer interface. A nil V is NULL.
+func (j JSON) Value() (driver.Value, error) {
+	if j.V == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of jsonb. That of json is the text itself.
+func (j JSON) MarshalBinary() ([]byte, error) {
+	b, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{jsonbVersion}, b...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, reading the
+// binary wire format of either json or jsonb.
+func (j JSON) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(trimJSONBVersion(data), j.V)
+}
+
+// trimJSONBVersion strips the version byte of binary jsonb. JSON text
+// may start with whitespace, but never with that byte.
+func trimJSONBVersion(data []byte) []byte {
+	if len(data) > 0 && data[0] == jsonbVersion {
+		return data[1:]
+	}
+	return data
+}
+
+// JSONArray is a json[] or jsonb[] value. NULL elements are nil.
+type JSONArray []json.RawMessage
+
+// Scan implements the Scanner interface.
+func (a *JSONArray) Scan(value interface{}) error {
+	src, ok := value.([]byte)
+	if !ok {
+		if value == nil {
+			*a = nil
+			return nil
+		}
+		return fmt.Errorf("pq: cannot scan %T into JSONArray", value)
+	}
+
+	elems, err := parseArray(src, ',')
+	if err != nil {
+		return err
+	}
+
+	b := make(JSONArray, len(elems))
+	for i, e := range elems {
+		if e != nil {
+			b[i] = json.RawMessage(append([]byte(nil), e...))
+		}
+	}
+	*a = b
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (a JSONArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	elems := make([][]byte, len(a))
+	for i, e := range a {
+		if e != nil && !json.Valid(e) {
+			return nil, errors.New("pq: invalid JSON in JSONArray")
+		}
+		elems[i] = e
+	}
+	return string(appendArray(nil, elems, ',')), nil
+}
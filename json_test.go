@@ -0,0 +1,161 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONScanValue(t *testing.T) {
+	type doc struct {
+		A int      `json:"a"`
+		B []string `json:"b"`
+	}
+	want := doc{A: 1, B: []string{"x", "y"}}
+
+	v, err := JSON{want}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []interface{}{v, []byte(v.(string)), []byte("\n" + v.(string))} {
+		var got doc
+		if err := (JSON{&got}).Scan(src); err != nil {
+			t.Fatalf("%q: %v", src, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %v, got %v", src, want, got)
+		}
+	}
+
+	m := map[string]int{"a": 1}
+	if err := (JSON{&m}).Scan(nil); err != nil || m != nil {
+		t.Errorf("expected nil map, got %v, %v", m, err)
+	}
+
+	if err := (JSON{&m}).Scan([]byte{1, '{', '}'}); err == nil {
+		t.Error("expected error for text starting with a jsonb version byte")
+	}
+
+	if v, _ := (JSON{}).Value(); v != nil {
+		t.Errorf("expected NULL, got %v", v)
+	}
+}
+
+func TestJSONBinary(t *testing.T) {
+	b, err := JSON{[]int{1, 2}}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "\x01[1,2]" {
+		t.Errorf("unexpected %q", b)
+	}
+
+	var got []int
+	if err := (JSON{&got}).UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("unexpected %v", got)
+	}
+
+	// The binary format of json is its text.
+	got = nil
+	if err := (JSON{&got}).UnmarshalBinary([]byte("\n[3]")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("unexpected %v", got)
+	}
+}
+
+func TestJSONArray(t *testing.T) {
+	var a JSONArray
+	if err := a.Scan([]byte(`{"{\"a\": 1}",NULL,"[1, 2]"}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := JSONArray{json.RawMessage(`{"a": 1}`), nil, json.RawMessage(`[1, 2]`)}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("expected %q, got %q", want, a)
+	}
+
+	v, err := a.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != `{"{\"a\": 1}",NULL,"[1, 2]"}` {
+		t.Errorf("unexpected %v", v)
+	}
+
+	if _, err := (JSONArray{json.RawMessage("{")}).Value(); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestCheckNamedValueRawMessage(t *testing.T) {
+	cn := &conn{}
+	for _, c := range []struct {
+		in   interface{}
+		want driver.Value
+	}{
+		{json.RawMessage(`{"a":1}`), `{"a":1}`},
+		{json.RawMessage(nil), nil},
+	} {
+		nv := driver.NamedValue{Value: c.in}
+		if err := cn.CheckNamedValue(&nv); err != nil {
+			t.Fatal(err)
+		}
+		if nv.Value != c.want {
+			t.Errorf("expected %#v, got %#v", c.want, nv.Value)
+		}
+	}
+
+	nv := driver.NamedValue{Value: int64(1)}
+	if err := cn.CheckNamedValue(&nv); err != driver.ErrSkip {
+		t.Errorf("expected ErrSkip, got %v", err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	for _, typ := range []string{"json", "jsonb"} {
+		var got map[string]interface{}
+		err := db.QueryRow("SELECT $1::"+typ, JSON{map[string]interface{}{"a": "b"}}).Scan(JSON{&got})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["a"] != "b" {
+			t.Errorf("%s: unexpected %v", typ, got)
+		}
+
+		var s string
+		err = db.QueryRow("SELECT ($1::"+typ+")->>'a'", json.RawMessage(`{"a":"c"}`)).Scan(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != "c" {
+			t.Errorf("%s: expected c, got %s", typ, s)
+		}
+
+		got = nil
+		err = db.QueryRow("SELECT E'\\n{\"a\": \"d\"}'::" + typ).Scan(JSON{&got})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["a"] != "d" {
+			t.Errorf("%s: unexpected %v", typ, got)
+		}
+
+		var a JSONArray
+		err = db.QueryRow("SELECT ARRAY['1', NULL, '{\"x\":[2]}']::" + typ + "[]").Scan(&a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a) != 3 || string(a[0]) != "1" || a[1] != nil {
+			t.Errorf("%s: unexpected %q", typ, a)
+		}
+	}
+}
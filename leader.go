@@ -0,0 +1,190 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Leader elects one leader among the processes contending for the same
+// advisory lock key, typically so that exactly one instance of a
+// worker runs some loop:
+//
+//	l := pq.NewLeader(db, pq.Key(42), 5*time.Second)
+//	go l.Run(ctx)
+//	for {
+//		select {
+//		case <-l.Gained():
+//			// start the loop
+//		case <-l.Lost():
+//			// stop it
+//		}
+//	}
+//
+// The candidate holding the lock is the leader. It checks every
+// interval that its connection is alive and still holds the lock, and
+// steps down as soon as that cannot be confirmed, including when the
+// connection is lost (driver.ErrBadConn); the other candidates try to
+// take the lock every interval.
+type Leader struct {
+	// OnError, if not nil, is called with errors from taking or
+	// checking the lock. Run carries on after them.
+	OnError func(error)
+
+	lock     *AdvisoryLock
+	interval time.Duration
+	gained   chan struct{}
+	lost     chan struct{}
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// NewLeader returns a candidate for leadership of key, using
+// connections from db and checking its state every interval.
+func NewLeader(db *sql.DB, key AdvisoryLockKey, interval time.Duration) *Leader {
+	return &Leader{
+		lock:     NewAdvisoryLock(db, key),
+		interval: interval,
+		gained:   make(chan struct{}, 1),
+		lost:     make(chan struct{}, 1),
+	}
+}
+
+// Gained returns a channel that receives a value when l becomes the
+// leader. Notifications are not queued: a receiver that falls behind
+// sees only the latest change.
+func (l *Leader) Gained() <-chan struct{} {
+	return l.gained
+}
+
+// Lost returns a channel that receives a value when l stops being the
+// leader. Notifications are not queued, as for Gained.
+func (l *Leader) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// IsLeader reports whether l is currently the leader.
+func (l *Leader) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leader
+}
+
+// Run takes part in the election until ctx is done, then gives up
+// leadership if it has it and returns ctx's error. Run must be called
+// only once.
+func (l *Leader) Run(ctx context.Context) error {
+	defer l.resign()
+
+	t := time.NewTicker(l.interval)
+	defer t.Stop()
+
+	for {
+		l.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (l *Leader) check(ctx context.Context) {
+	cctx, cancel := context.WithTimeout(ctx, l.interval)
+	defer cancel()
+
+	if l.lock.Conn() == nil {
+		ok, err := l.lock.TryLock(cctx)
+		if err != nil {
+			l.error(err)
+		} else if ok {
+			l.setLeader(true)
+		}
+		return
+	}
+
+	// Should the check hang, for example because the network has
+	// gone, stop claiming leadership once the interval is up, without
+	// waiting for the check to fail. The connection is then given up
+	// along with the lock: it is closed once the check returns, which
+	// releases the lock should the session still hold it.
+	type result struct {
+		held bool
+		err  error
+	}
+	c := l.lock.Conn()
+	done := make(chan result, 1)
+	go func() {
+		held, err := l.lock.heldOn(cctx, c)
+		done <- result{held, err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-cctx.Done():
+		l.lock.conn = nil
+		l.setLeader(false)
+		go func() {
+			<-done
+			discardConn(c)
+		}()
+		return
+	}
+
+	if r.err != nil || !r.held {
+		if r.err != nil {
+			l.error(r.err)
+		}
+		l.lock.discard()
+		l.setLeader(false)
+		return
+	}
+	l.setLeader(true)
+}
+
+func (l *Leader) resign() {
+	if l.lock.Conn() != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+		if err := l.lock.Unlock(ctx); err != nil && err != ErrLockNotHeld {
+			l.error(err)
+		}
+		cancel()
+	}
+	l.setLeader(false)
+}
+
+func (l *Leader) setLeader(leader bool) {
+	l.mu.Lock()
+	changed := l.leader != leader
+	l.leader = leader
+	l.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	// Drop an unread notification of the opposite change, so that a
+	// receiver catching up cannot see the two out of order.
+	ch, stale := l.lost, l.gained
+	if leader {
+		ch, stale = l.gained, l.lost
+	}
+	select {
+	case <-stale:
+	default:
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (l *Leader) error(err error) {
+	if l.OnError != nil {
+		l.OnError(err)
+	}
+}
@@ -0,0 +1,73 @@
+package pq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaderNotifications(t *testing.T) {
+	l := NewLeader(nil, Key(1), time.Second)
+
+	l.setLeader(true)
+	l.setLeader(true)
+	if !l.IsLeader() {
+		t.Fatal("expected to be leader")
+	}
+
+	// Losing leadership before the gain was seen must leave only the
+	// loss to be received.
+	l.setLeader(false)
+	select {
+	case <-l.Gained():
+		t.Fatal("unexpected stale gained notification")
+	case <-l.Lost():
+	default:
+		t.Fatal("expected lost notification")
+	}
+
+	if l.IsLeader() {
+		t.Fatal("expected not to be leader")
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	key := Key(0x7067676f6c656164)
+	l1 := NewLeader(db, key, 50*time.Millisecond)
+	l2 := NewLeader(db, key, 50*time.Millisecond)
+
+	done1 := make(chan error, 1)
+	go func() { done1 <- l1.Run(ctx) }()
+
+	select {
+	case <-l1.Gained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("l1 was not elected")
+	}
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go l2.Run(ctx2)
+
+	time.Sleep(200 * time.Millisecond)
+	if l2.IsLeader() {
+		t.Fatal("expected only one leader")
+	}
+
+	// Once l1 resigns, l2 takes over.
+	cancel()
+	<-done1
+	if l1.IsLeader() {
+		t.Fatal("expected l1 to have resigned")
+	}
+
+	select {
+	case <-l2.Gained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("l2 was not elected")
+	}
+}
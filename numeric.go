@@ -0,0 +1,409 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var errNumericNotFinite = errors.New("pq: numeric is NaN or infinite")
+
+// The most digits a NUMERIC value can have before and after the decimal
+// point.
+const (
+	numericMaxWeight = 131072
+	numericMaxScale  = 16383
+)
+
+// Numeric is an exact decimal number, suitable for scanning NUMERIC
+// columns and passing NUMERIC parameters without the rounding of
+// float64. Its value is Int × 10^Exp, unless it is NaN or infinite.
+// The zero Numeric is NULL.
+type Numeric struct {
+	Int *big.Int // unscaled value; nil means zero
+	Exp int32
+
+	NaN bool
+	Inf int // 1 for Infinity, -1 for -Infinity, otherwise 0
+
+	Valid bool // Valid is false if the Numeric is NULL
+}
+
+// ParseNumeric parses a decimal number such as "-12.340", "1.5e-7",
+// "NaN", "Infinity" or "-Infinity". Trailing zeros after the decimal
+// point are kept in the exponent, as NUMERIC keeps them in its scale.
+// Values with more digits before or after the decimal point than
+// NUMERIC allows are refused.
+func ParseNumeric(s string) (Numeric, error) {
+	switch s {
+	case "NaN":
+		return Numeric{NaN: true, Valid: true}, nil
+	case "Infinity", "+Infinity":
+		return Numeric{Inf: 1, Valid: true}, nil
+	case "-Infinity":
+		return Numeric{Inf: -1, Valid: true}, nil
+	}
+
+	mant, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Numeric{}, fmt.Errorf("pq: invalid numeric %q", s)
+		}
+		mant = s[:i]
+	}
+
+	if i := strings.IndexByte(mant, '.'); i >= 0 {
+		exp -= int64(len(mant) - i - 1)
+		mant = mant[:i] + mant[i+1:]
+	}
+
+	digits := strings.TrimLeft(mant, "+-")
+	if digits == "" || len(mant)-len(digits) > 1 || strings.Trim(digits, "0123456789") != "" {
+		return Numeric{}, fmt.Errorf("pq: invalid numeric %q", s)
+	}
+
+	if sig := strings.TrimLeft(digits, "0"); -exp > numericMaxScale ||
+		sig != "" && int64(len(sig))+exp > numericMaxWeight {
+		return Numeric{}, fmt.Errorf("pq: numeric exponent out of range in %q", s)
+	}
+
+	n, _ := new(big.Int).SetString(mant, 10)
+	return Numeric{Int: n, Exp: int32(exp), Valid: true}, nil
+}
+
+// String formats n as PostgreSQL does, in plain decimal notation.
+func (n Numeric) String() string {
+	switch {
+	case !n.Valid:
+		return "NULL"
+	case n.NaN:
+		return "NaN"
+	case n.Inf > 0:
+		return "Infinity"
+	case n.Inf < 0:
+		return "-Infinity"
+	}
+
+	i := n.Int
+	if i == nil {
+		i = new(big.Int)
+	}
+
+	s := new(big.Int).Abs(i).String()
+	if n.Exp >= 0 {
+		if i.Sign() != 0 {
+			s += strings.Repeat("0", int(n.Exp))
+		}
+	} else {
+		scale := int(-n.Exp)
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+
+	if i.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Scan implements the Scanner interface.
+func (n *Numeric) Scan(value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		*n = Numeric{}
+	case []byte:
+		*n, err = ParseNumeric(string(v))
+	case string:
+		*n, err = ParseNumeric(v)
+	case int64:
+		*n = Numeric{Int: big.NewInt(v), Valid: true}
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			*n = Numeric{NaN: true, Valid: true}
+		case math.IsInf(v, 0):
+			*n = Numeric{Inf: int(math.Copysign(1, v)), Valid: true}
+		default:
+			*n, err = ParseNumeric(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	default:
+		err = fmt.Errorf("pq: cannot scan %T into Numeric", value)
+	}
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (n Numeric) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.String(), nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (n Numeric) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (n *Numeric) UnmarshalText(text []byte) (err error) {
+	*n, err = ParseNumeric(string(text))
+	return err
+}
+
+// Rat returns n as a *big.Rat. It fails if n is NULL, NaN or infinite.
+func (n Numeric) Rat() (*big.Rat, error) {
+	if err := n.checkFinite(); err != nil {
+		return nil, err
+	}
+
+	r := new(big.Rat)
+	if n.Int != nil {
+		r.SetInt(n.Int)
+	}
+
+	p := pow10(abs32(n.Exp))
+	if n.Exp >= 0 {
+		return r.Mul(r, new(big.Rat).SetInt(p)), nil
+	}
+	return r.Quo(r, new(big.Rat).SetInt(p)), nil
+}
+
+// BigInt returns n rounded to an integer using mode. It fails if n is
+// NULL, NaN or infinite.
+func (n Numeric) BigInt(mode big.RoundingMode) (*big.Int, error) {
+	if err := n.checkFinite(); err != nil {
+		return nil, err
+	}
+
+	i := new(big.Int)
+	if n.Int != nil {
+		i.Set(n.Int)
+	}
+
+	if n.Exp >= 0 {
+		return i.Mul(i, pow10(n.Exp)), nil
+	}
+
+	d := pow10(-n.Exp)
+	q, r := i.QuoRem(i, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q, nil
+	}
+
+	// q has been truncated towards zero; step away from zero if the
+	// mode calls for it.
+	away := false
+	switch mode {
+	case big.ToZero:
+	case big.AwayFromZero:
+		away = true
+	case big.ToNegativeInf:
+		away = r.Sign() < 0
+	case big.ToPositiveInf:
+		away = r.Sign() > 0
+	case big.ToNearestAway, big.ToNearestEven:
+		c := new(big.Int).Abs(r)
+		c.Lsh(c, 1)
+		switch c.Cmp(d) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == big.ToNearestAway || q.Bit(0) == 1
+		}
+	}
+
+	if away {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+	return q, nil
+}
+
+// Float64 returns the float64 nearest to n in the direction given by
+// mode, and whether that was exact. NaN and infinities convert to
+// their float64 counterparts; NULL fails.
+func (n Numeric) Float64(mode big.RoundingMode) (float64, big.Accuracy, error) {
+	switch {
+	case !n.Valid:
+		return 0, big.Exact, errors.New("pq: numeric is NULL")
+	case n.NaN:
+		return math.NaN(), big.Exact, nil
+	case n.Inf != 0:
+		return math.Inf(n.Inf), big.Exact, nil
+	}
+
+	r, _ := n.Rat()
+	f := new(big.Float).SetPrec(53).SetMode(mode).SetRat(r)
+	v, _ := f.Float64()
+	return v, f.Acc(), nil
+}
+
+func (n Numeric) checkFinite() error {
+	switch {
+	case !n.Valid:
+		return errors.New("pq: numeric is NULL")
+	case n.NaN || n.Inf != 0:
+		return errNumericNotFinite
+	}
+	return nil
+}
+
+// The binary format of numeric holds base 10000 digits, most
+// significant first, with the weight of the first one and the display
+// scale.
+const (
+	numericPos  = 0x0000
+	numericNeg  = 0x4000
+	numericNaN  = 0xC000
+	numericPInf = 0xD000
+	numericNInf = 0xF000
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of numeric.
+func (n Numeric) MarshalBinary() ([]byte, error) {
+	w := make(writeBuf, 0, 8)
+	switch {
+	case !n.Valid:
+		return nil, errors.New("pq: numeric is NULL")
+	case n.NaN, n.Inf != 0:
+		sign := numericNaN
+		if n.Inf > 0 {
+			sign = numericPInf
+		} else if n.Inf < 0 {
+			sign = numericNInf
+		}
+		w.int16(0)
+		w.int16(0)
+		w.int16(sign)
+		w.int16(0)
+		return w, nil
+	}
+
+	dscale := 0
+	if n.Exp < 0 {
+		dscale = int(-n.Exp)
+	}
+
+	// Align the exponent to a multiple of 4 to split the value into
+	// base 10000 digits.
+	i := new(big.Int)
+	if n.Int != nil {
+		i.Abs(n.Int)
+	}
+	exp := int(n.Exp)
+	if m := ((exp % 4) + 4) % 4; m != 0 {
+		i.Mul(i, pow10(int32(m)))
+		exp -= m
+	}
+
+	var digits []int
+	base, d := big.NewInt(10000), new(big.Int)
+	for i.Sign() > 0 {
+		i.QuoRem(i, base, d)
+		if len(digits) == 0 && d.Sign() == 0 {
+			// trailing zero digit
+			exp += 4
+			continue
+		}
+		digits = append(digits, int(d.Int64()))
+	}
+
+	sign := numericPos
+	if n.Int != nil && n.Int.Sign() < 0 {
+		sign = numericNeg
+	}
+
+	weight := 0
+	if len(digits) > 0 {
+		weight = len(digits) - 1 + exp/4
+	}
+
+	w.int16(len(digits))
+	w.int16(weight)
+	w.int16(sign)
+	w.int16(dscale)
+	for k := len(digits) - 1; k >= 0; k-- {
+		w.int16(digits[k])
+	}
+	return w, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, reading the
+// binary wire format of numeric.
+func (n *Numeric) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return errors.New("pq: invalid binary numeric")
+	}
+
+	ndigits := int(binary.BigEndian.Uint16(data))
+	weight := int(int16(binary.BigEndian.Uint16(data[2:])))
+	sign := int(binary.BigEndian.Uint16(data[4:]))
+	dscale := int(binary.BigEndian.Uint16(data[6:]))
+	data = data[8:]
+	if len(data) != 2*ndigits {
+		return errors.New("pq: invalid binary numeric")
+	}
+
+	switch sign {
+	case numericNaN:
+		*n = Numeric{NaN: true, Valid: true}
+		return nil
+	case numericPInf:
+		*n = Numeric{Inf: 1, Valid: true}
+		return nil
+	case numericNInf:
+		*n = Numeric{Inf: -1, Valid: true}
+		return nil
+	case numericPos, numericNeg:
+	default:
+		return fmt.Errorf("pq: invalid binary numeric sign %#x", sign)
+	}
+
+	i := new(big.Int)
+	base := big.NewInt(10000)
+	for k := 0; k < ndigits; k++ {
+		i.Mul(i, base)
+		i.Add(i, big.NewInt(int64(binary.BigEndian.Uint16(data[2*k:]))))
+	}
+
+	// Scale to exactly dscale decimal places, as the text form has.
+	exp := (weight - ndigits + 1) * 4
+	if ndigits == 0 {
+		exp = 0
+	}
+	if exp > -dscale {
+		i.Mul(i, pow10(int32(exp+dscale)))
+	} else if exp < -dscale {
+		i.Quo(i, pow10(int32(-dscale-exp)))
+	}
+	exp = -dscale
+
+	if sign == numericNeg {
+		i.Neg(i)
+	}
+
+	*n = Numeric{Int: i, Exp: int32(exp), Valid: true}
+	return nil
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func abs32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
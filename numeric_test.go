@@ -0,0 +1,168 @@
+package pq
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseNumeric(t *testing.T) {
+	for s, want := range map[string]string{
+		"0":         "0",
+		"-12.340":   "-12.340",
+		"0.0001":    "0.0001",
+		"1.5e-7":    "0.00000015",
+		"12e3":      "12000",
+		"NaN":       "NaN",
+		"Infinity":  "Infinity",
+		"-Infinity": "-Infinity",
+		"+7":        "7",
+		"-.5":       "-0.5",
+		"123456789012345678901234567890.123456789012345678901234567890": "123456789012345678901234567890.123456789012345678901234567890",
+	} {
+		n, err := ParseNumeric(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if got := n.String(); got != want {
+			t.Errorf("%q: expected %s, got %s", s, want, got)
+		}
+	}
+
+	for _, s := range []string{"", "-", "1..2", "--1", "1e", "abc", "1.2.3",
+		"1e2000000000", "1e131072", "12e131071", "1e-16384", "0.1e-16383"} {
+		if _, err := ParseNumeric(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+
+	// The limits of NUMERIC itself.
+	for _, s := range []string{"1e131071", "0012e131070", "1e-16383", "0e200000"} {
+		if _, err := ParseNumeric(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+}
+
+func TestNumericBinary(t *testing.T) {
+	for _, s := range []string{
+		"0", "0.00", "12.340", "-12.340", "10000", "123456789.000000001",
+		"0.0000001", "-1e20", "NaN", "Infinity", "-Infinity",
+	} {
+		n, err := ParseNumeric(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := n.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+
+		var got Numeric
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+
+		want := n.String()
+		if n.Exp > 0 {
+			// the binary form has no negative scale
+			r, _ := n.Rat()
+			want = r.FloatString(0)
+		}
+		if got.String() != want {
+			t.Errorf("%s: round trip gave %s", s, got.String())
+		}
+	}
+
+	// 12.340 as sent by the server: digits 12 and 3400, weight 0,
+	// display scale 3.
+	var n Numeric
+	err := n.UnmarshalBinary([]byte{0, 2, 0, 0, 0, 0, 0, 3, 0, 12, 0x0d, 0x48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.String() != "12.340" {
+		t.Fatalf("expected 12.340, got %s", n)
+	}
+}
+
+func TestNumericConversions(t *testing.T) {
+	n, _ := ParseNumeric("-2.5")
+
+	tests := []struct {
+		mode big.RoundingMode
+		want int64
+	}{
+		{big.ToNearestEven, -2},
+		{big.ToNearestAway, -3},
+		{big.ToZero, -2},
+		{big.AwayFromZero, -3},
+		{big.ToNegativeInf, -3},
+		{big.ToPositiveInf, -2},
+	}
+	for _, test := range tests {
+		i, err := n.BigInt(test.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i.Int64() != test.want {
+			t.Errorf("%v: expected %d, got %s", test.mode, test.want, i)
+		}
+	}
+
+	r, err := n.Rat()
+	if err != nil || r.Cmp(big.NewRat(-5, 2)) != 0 {
+		t.Fatalf("expected -5/2, got %v, %v", r, err)
+	}
+
+	third, _ := ParseNumeric("0.3333333333333333333333")
+	lo, acc, _ := third.Float64(big.ToZero)
+	hi, _, _ := third.Float64(big.ToPositiveInf)
+	if acc != big.Below || !(lo < hi) {
+		t.Fatalf("expected directed rounding, got %v (%v) and %v", lo, acc, hi)
+	}
+
+	inf := Numeric{Inf: -1, Valid: true}
+	if f, _, _ := inf.Float64(big.ToNearestEven); !math.IsInf(f, -1) {
+		t.Fatalf("expected -Inf, got %v", f)
+	}
+	if _, err := inf.BigInt(big.ToZero); err == nil {
+		t.Fatal("expected error converting infinity to an integer")
+	}
+}
+
+func TestNumericScanValue(t *testing.T) {
+	var n Numeric
+	if err := n.Scan([]byte("3.14")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := n.Value(); v != "3.14" {
+		t.Fatalf("expected 3.14, got %v", v)
+	}
+
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Fatalf("expected NULL, got %v, %v", n, err)
+	}
+	if v, _ := n.Value(); v != nil {
+		t.Fatalf("expected nil, got %v", v)
+	}
+}
+
+func TestNumericRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	for _, s := range []string{"123456789012345678901234567890.000000000000000000001", "NaN", "-0.5"} {
+		in, _ := ParseNumeric(s)
+		var out Numeric
+		err := db.QueryRow("SELECT $1::numeric", in).Scan(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != s {
+			t.Errorf("expected %s, got %s", s, out)
+		}
+	}
+}
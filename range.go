@@ -0,0 +1,741 @@
+package pq
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Range is a value of a range type, such as int4range, int8range,
+// numrange, tsrange, tstzrange or daterange. T is the type of the
+// bounds: int64, int32, int, float64, time.Time, string, []byte, or a
+// type whose pointer implements sql.Scanner, such as Numeric.
+//
+//	var r pq.Range[time.Time]
+//	err := db.QueryRow("SELECT during FROM booking").Scan(&r)
+//
+// An unbounded side has its Inf field set, and its bound is ignored.
+// Empty ranges have only Empty set.
+type Range[T any] struct {
+	Lower, Upper       T
+	LowerInc, UpperInc bool // whether the bounds are inclusive
+	LowerInf, UpperInf bool // whether the sides are unbounded
+	Empty              bool
+}
+
+// The flags that start the binary format of ranges.
+const (
+	rangeEmpty    = 0x01
+	rangeLowerInc = 0x02
+	rangeUpperInc = 0x04
+	rangeLowerInf = 0x08
+	rangeUpperInf = 0x10
+)
+
+// String formats r as the server does, as in [1,5) or empty. It shows
+// bounds it cannot format as "?".
+func (r Range[T]) String() string {
+	b, err := r.appendText(nil)
+	if err != nil {
+		return "?"
+	}
+	return string(b)
+}
+
+func (r Range[T]) appendText(b []byte) ([]byte, error) {
+	if r.Empty {
+		return append(b, "empty"...), nil
+	}
+
+	b = append(b, "(["[btoi(r.LowerInc)])
+	if !r.LowerInf {
+		t, err := rangeBoundText(r.Lower)
+		if err != nil {
+			return nil, err
+		}
+		b = appendQuotedBound(b, t)
+	}
+	b = append(b, ',')
+	if !r.UpperInf {
+		t, err := rangeBoundText(r.Upper)
+		if err != nil {
+			return nil, err
+		}
+		b = appendQuotedBound(b, t)
+	}
+	return append(b, ")]"[btoi(r.UpperInc)]), nil
+}
+
+// Scan implements the Scanner interface. It accepts the text and the
+// binary format. NULL scans as the zero Range; scan into a **Range to
+// tell it apart.
+func (r *Range[T]) Scan(value interface{}) error {
+	var src string
+	switch v := value.(type) {
+	case nil:
+		*r = Range[T]{}
+		return nil
+	case []byte:
+		// Text starts with a bracket, a space or "empty"; binary
+		// with flags below 0x20.
+		if len(v) > 0 && v[0] < 0x20 {
+			return r.UnmarshalBinary(v)
+		}
+		src = string(v)
+	case string:
+		src = v
+	default:
+		return fmt.Errorf("pq: cannot scan %T into Range", value)
+	}
+
+	rt, n, err := parseRange(src, 0)
+	if err == nil && strings.TrimSpace(src[n:]) != "" {
+		err = errors.New("trailing characters")
+	}
+	if err != nil {
+		return fmt.Errorf("pq: invalid range %q: %v", src, err)
+	}
+	return r.set(rt)
+}
+
+func (r *Range[T]) set(rt rangeText) error {
+	v := Range[T]{
+		Empty:    rt.empty,
+		LowerInc: rt.lowerInc,
+		UpperInc: rt.upperInc,
+		LowerInf: rt.lowerInf,
+		UpperInf: rt.upperInf,
+	}
+	if !rt.empty && !rt.lowerInf {
+		if err := scanRangeBound(&v.Lower, rt.lower); err != nil {
+			return err
+		}
+	}
+	if !rt.empty && !rt.upperInf {
+		if err := scanRangeBound(&v.Upper, rt.upper); err != nil {
+			return err
+		}
+	}
+	*r = v
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (r Range[T]) Value() (driver.Value, error) {
+	b, err := r.appendText(nil)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of ranges: flags, then each finite bound with its
+// length. Bounds are formatted by their type: int32 as int4, int64 and
+// int as int8, and time.Time as timestamp. Use MarshalBinaryType for
+// other range types, such as daterange.
+func (r Range[T]) MarshalBinary() ([]byte, error) {
+	return r.marshalBinary(t_unknown)
+}
+
+// MarshalBinaryType is like MarshalBinary, but formats the bounds as
+// the element type of typ, a built-in range or multirange type such as
+// "int4range" or "daterange". An int bound of an int4range takes 4
+// bytes, and a time.Time bound of a daterange is sent as a date.
+func (r Range[T]) MarshalBinaryType(typ string) ([]byte, error) {
+	elem, ok := rangeElemTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("pq: unknown range type %q", typ)
+	}
+	return r.marshalBinary(elem)
+}
+
+func (r Range[T]) marshalBinary(elem oid) ([]byte, error) {
+	if r.Empty {
+		return []byte{rangeEmpty}, nil
+	}
+
+	var flags byte
+	if r.LowerInc {
+		flags |= rangeLowerInc
+	}
+	if r.UpperInc {
+		flags |= rangeUpperInc
+	}
+	if r.LowerInf {
+		flags |= rangeLowerInf
+	}
+	if r.UpperInf {
+		flags |= rangeUpperInf
+	}
+
+	b := []byte{flags}
+	for _, bound := range []struct {
+		inf bool
+		v   T
+	}{{r.LowerInf, r.Lower}, {r.UpperInf, r.Upper}} {
+		if bound.inf {
+			continue
+		}
+		e, err := marshalRangeBound(bound.v, elem)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(len(e)))
+		b = append(b, e...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (r *Range[T]) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("pq: invalid binary range")
+	}
+
+	flags := data[0]
+	data = data[1:]
+	v := Range[T]{
+		Empty:    flags&rangeEmpty != 0,
+		LowerInc: flags&rangeLowerInc != 0,
+		UpperInc: flags&rangeUpperInc != 0,
+		LowerInf: flags&rangeLowerInf != 0,
+		UpperInf: flags&rangeUpperInf != 0,
+	}
+
+	if !v.Empty {
+		for _, bound := range []struct {
+			inf bool
+			dst *T
+		}{{v.LowerInf, &v.Lower}, {v.UpperInf, &v.Upper}} {
+			if bound.inf {
+				continue
+			}
+			if len(data) < 4 || uint64(len(data)-4) < uint64(binary.BigEndian.Uint32(data)) {
+				return errors.New("pq: invalid binary range")
+			}
+			n := binary.BigEndian.Uint32(data)
+			if err := unmarshalRangeBound(bound.dst, data[4:4+n]); err != nil {
+				return err
+			}
+			data = data[4+n:]
+		}
+	}
+	if len(data) != 0 {
+		return errors.New("pq: invalid binary range")
+	}
+	*r = v
+	return nil
+}
+
+// Multirange is a value of a multirange type, such as int4multirange
+// or tstzmultirange, which the server has since version 14. A nil
+// Multirange is NULL.
+type Multirange[T any] []Range[T]
+
+// Scan implements the Scanner interface. It accepts the text and the
+// binary format.
+func (m *Multirange[T]) Scan(value interface{}) error {
+	var src string
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		// The binary format starts with the count of ranges.
+		if len(v) > 0 && v[0] < 0x20 {
+			return m.UnmarshalBinary(v)
+		}
+		src = string(v)
+	case string:
+		src = v
+	default:
+		return fmt.Errorf("pq: cannot scan %T into Multirange", value)
+	}
+
+	mr, err := parseMultirange[T](src)
+	if err != nil {
+		return err
+	}
+	*m = mr
+	return nil
+}
+
+func parseMultirange[T any](src string) (Multirange[T], error) {
+	fail := func(err error) (Multirange[T], error) {
+		return nil, fmt.Errorf("pq: invalid multirange %q: %v", src, err)
+	}
+
+	s := strings.TrimSpace(src)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return fail(errors.New("missing braces"))
+	}
+	s = s[1 : len(s)-1]
+
+	mr := Multirange[T]{}
+	if strings.TrimSpace(s) == "" {
+		return mr, nil
+	}
+	for i := 0; ; {
+		rt, n, err := parseRange(s, i)
+		if err != nil {
+			return fail(err)
+		}
+		var r Range[T]
+		if err := r.set(rt); err != nil {
+			return nil, err
+		}
+		mr = append(mr, r)
+
+		rest := strings.TrimLeft(s[n:], " ")
+		if rest == "" {
+			return mr, nil
+		}
+		if rest[0] != ',' {
+			return fail(errors.New("missing comma"))
+		}
+		i = len(s) - len(rest) + 1
+	}
+}
+
+// Value implements the driver Valuer interface.
+func (m Multirange[T]) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	b := []byte{'{'}
+	for i, r := range m {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		if b, err = r.appendText(b); err != nil {
+			return nil, err
+		}
+	}
+	return string(append(b, '}')), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of multiranges: the count of ranges, then each
+// range with its length.
+func (m Multirange[T]) MarshalBinary() ([]byte, error) {
+	return m.marshalBinary(t_unknown)
+}
+
+// MarshalBinaryType is like MarshalBinary, but formats the bounds as
+// Range.MarshalBinaryType does for typ.
+func (m Multirange[T]) MarshalBinaryType(typ string) ([]byte, error) {
+	elem, ok := rangeElemTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("pq: unknown range type %q", typ)
+	}
+	return m.marshalBinary(elem)
+}
+
+func (m Multirange[T]) marshalBinary(elem oid) ([]byte, error) {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(m)))
+	for _, r := range m {
+		e, err := r.marshalBinary(elem)
+		if err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(len(e)))
+		b = append(b, e...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *Multirange[T]) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("pq: invalid binary multirange")
+	}
+	count := binary.BigEndian.Uint32(data)
+	data = data[4:]
+
+	mr := Multirange[T]{}
+	for k := uint32(0); k < count; k++ {
+		if len(data) < 4 || uint64(len(data)-4) < uint64(binary.BigEndian.Uint32(data)) {
+			return errors.New("pq: invalid binary multirange")
+		}
+		n := binary.BigEndian.Uint32(data)
+		var r Range[T]
+		if err := r.UnmarshalBinary(data[4 : 4+n]); err != nil {
+			return err
+		}
+		mr = append(mr, r)
+		data = data[4+n:]
+	}
+	if len(data) != 0 {
+		return errors.New("pq: invalid binary multirange")
+	}
+	*m = mr
+	return nil
+}
+
+// rangeText is a range in the text format, with its bounds unquoted.
+type rangeText struct {
+	empty              bool
+	lowerInc, upperInc bool
+	lowerInf, upperInf bool
+	lower, upper       []byte
+}
+
+// parseRange parses the range starting at s[i], returning the index
+// after it.
+func parseRange(s string, i int) (rt rangeText, n int, err error) {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if len(s)-i >= 5 && strings.EqualFold(s[i:i+5], "empty") {
+		return rangeText{empty: true}, i + 5, nil
+	}
+
+	if i == len(s) || (s[i] != '[' && s[i] != '(') {
+		return rt, 0, errors.New("missing lower bracket")
+	}
+	rt.lowerInc = s[i] == '['
+
+	rt.lower, rt.lowerInf, i = parseRangeBound(s, i+1, ",")
+	if i == len(s) {
+		return rt, 0, errors.New("missing comma")
+	}
+	rt.upper, rt.upperInf, i = parseRangeBound(s, i+1, ")]")
+	if i == len(s) {
+		return rt, 0, errors.New("missing upper bracket")
+	}
+	rt.upperInc = s[i] == ']'
+	return rt, i + 1, nil
+}
+
+// parseRangeBound reads a bound starting at s[i] up to one of the
+// characters in end, outside quotes. A bound that is empty and not
+// quoted is unbounded.
+func parseRangeBound(s string, i int, end string) (b []byte, inf bool, n int) {
+	quoted := false
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '"':
+			quoted = true
+			for i++; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				} else if s[i] == '"' {
+					if i+1 < len(s) && s[i+1] == '"' {
+						i++
+					} else {
+						break
+					}
+				}
+				b = append(b, s[i])
+			}
+			i++
+		case c == '\\' && i+1 < len(s):
+			b = append(b, s[i+1])
+			i += 2
+		case strings.IndexByte(end, c) >= 0:
+			return b, !quoted && len(b) == 0, i
+		default:
+			b = append(b, c)
+			i++
+		}
+	}
+	return b, !quoted && len(b) == 0, len(s)
+}
+
+func appendQuotedBound(b, t []byte) []byte {
+	b = append(b, '"')
+	for _, c := range t {
+		if c == '"' || c == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, c)
+	}
+	return append(b, '"')
+}
+
+// scanRangeBound sets dst from the text of a bound, using the decoders
+// of the built-in types for the types they decode to.
+func scanRangeBound(dst interface{}, b []byte) (err error) {
+	defer errRecover(&err)
+
+	switch d := dst.(type) {
+	case *int64:
+		*d = decode(b, t_int8).(int64)
+	case *int32:
+		n, err := strconv.ParseInt(string(b), 10, 32)
+		if err != nil {
+			return fmt.Errorf("pq: %v", err)
+		}
+		*d = int32(n)
+	case *int:
+		*d = int(decode(b, t_int8).(int64))
+	case *float64:
+		*d = decode(b, t_float8).(float64)
+	case *time.Time:
+		t, ok := decode(b, rangeTimeType(b)).(time.Time)
+		if !ok {
+			return fmt.Errorf("pq: cannot scan range bound %q into time.Time; see EnableInfinityTs", b)
+		}
+		*d = t
+	case *string:
+		*d = string(b)
+	case *[]byte:
+		*d = append([]byte(nil), b...)
+	case sql.Scanner:
+		return d.Scan(b)
+	default:
+		return fmt.Errorf("pq: unsupported range bound type %T", dst)
+	}
+	return nil
+}
+
+// rangeTimeType tells the type of a time bound by its form: a date, or
+// a timestamp with or without a time zone.
+func rangeTimeType(b []byte) oid {
+	i := bytes.IndexByte(b, ':')
+	switch {
+	case i < 0:
+		return t_date
+	case bytes.ContainsAny(b[i:], "+-"):
+		return t_timestamptz
+	}
+	return t_timestamp
+}
+
+// rangeBoundText returns the text of a bound, as encode sends it.
+func rangeBoundText(v interface{}) (b []byte, err error) {
+	defer errRecover(&err)
+
+	if f, ok := v.(float64); ok {
+		return strconv.AppendFloat(nil, f, 'g', -1, 64), nil
+	}
+	cv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if cv == nil {
+		return nil, errors.New("pq: range bound is NULL")
+	}
+	return encode(cv, t_unknown), nil
+}
+
+// rangeElemTypes maps the built-in range and multirange types to
+// their element types.
+var rangeElemTypes = map[string]oid{
+	"int4range":      t_int4,
+	"int8range":      t_int8,
+	"numrange":       t_numeric,
+	"tsrange":        t_timestamp,
+	"tstzrange":      t_timestamptz,
+	"daterange":      t_date,
+	"int4multirange": t_int4,
+	"int8multirange": t_int8,
+	"nummultirange":  t_numeric,
+	"tsmultirange":   t_timestamp,
+	"tstzmultirange": t_timestamptz,
+	"datemultirange": t_date,
+}
+
+// pgEpoch is the origin of the binary formats of date and timestamp.
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// marshalRangeBound returns the binary format of a bound of a range
+// whose element type is elem, or t_unknown to go by the type of v.
+func marshalRangeBound(v interface{}, elem oid) ([]byte, error) {
+	switch v := v.(type) {
+	case int64:
+		return marshalRangeInt(v, elem, t_int8)
+	case int32:
+		return marshalRangeInt(int64(v), elem, t_int4)
+	case int:
+		return marshalRangeInt(int64(v), elem, t_int8)
+	case float64:
+		switch elem {
+		case t_unknown:
+			return binary.BigEndian.AppendUint64(nil, math.Float64bits(v)), nil
+		case t_numeric:
+			n, err := ParseNumeric(strconv.FormatFloat(v, 'g', -1, 64))
+			if err != nil {
+				return nil, err
+			}
+			return n.MarshalBinary()
+		}
+	case time.Time:
+		switch elem {
+		case t_date:
+			return marshalDate(v)
+		case t_unknown, t_timestamp, t_timestamptz:
+			return marshalTimestamp(v)
+		}
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	default:
+		return nil, fmt.Errorf("pq: unsupported range bound type %T", v)
+	}
+	return nil, fmt.Errorf("pq: cannot format %T as a %s range bound", v, typeNames[elem])
+}
+
+func marshalRangeInt(n int64, elem, def oid) ([]byte, error) {
+	if elem == t_unknown {
+		elem = def
+	}
+	switch elem {
+	case t_int4:
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("pq: range bound %d out of range for int4", n)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(n)), nil
+	case t_int8:
+		return binary.BigEndian.AppendUint64(nil, uint64(n)), nil
+	case t_numeric:
+		return Numeric{Int: big.NewInt(n), Valid: true}.MarshalBinary()
+	}
+	return nil, fmt.Errorf("pq: cannot format an integer as a %s range bound", typeNames[elem])
+}
+
+// The binary formats of date and timestamp count days and microseconds
+// from pgEpoch, with the extreme values standing for the infinities.
+// Microseconds are counted from whole seconds, as a time.Duration from
+// pgEpoch only reaches 292 years either way.
+
+func marshalDate(t time.Time) ([]byte, error) {
+	var days int64
+	switch {
+	case infinityTsEnabled && !t.After(infinityTsNegative):
+		days = math.MinInt32
+	case infinityTsEnabled && !t.Before(infinityTsPositive):
+		days = math.MaxInt32
+	default:
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		days = (d.Unix() - pgEpoch.Unix()) / (24 * 60 * 60)
+		if days <= math.MinInt32 || days >= math.MaxInt32 {
+			return nil, fmt.Errorf("pq: date %v out of range", t)
+		}
+	}
+	return binary.BigEndian.AppendUint32(nil, uint32(days)), nil
+}
+
+func marshalTimestamp(t time.Time) ([]byte, error) {
+	var usec int64
+	switch {
+	case infinityTsEnabled && !t.After(infinityTsNegative):
+		usec = math.MinInt64
+	case infinityTsEnabled && !t.Before(infinityTsPositive):
+		usec = math.MaxInt64
+	default:
+		sec := t.Unix() - pgEpoch.Unix()
+		if sec <= math.MinInt64/1000000 || sec >= math.MaxInt64/1000000 {
+			return nil, fmt.Errorf("pq: timestamp %v out of range", t)
+		}
+		usec = sec*1e6 + int64(t.Nanosecond()/1e3)
+	}
+	return binary.BigEndian.AppendUint64(nil, uint64(usec)), nil
+}
+
+func unmarshalDate(days int64) (time.Time, error) {
+	switch days {
+	case math.MinInt32:
+		return binaryInfinity(infinityTsNegative)
+	case math.MaxInt32:
+		return binaryInfinity(infinityTsPositive)
+	}
+	return pgEpoch.AddDate(0, 0, int(days)), nil
+}
+
+func unmarshalTimestamp(usec int64) (time.Time, error) {
+	switch usec {
+	case math.MinInt64:
+		return binaryInfinity(infinityTsNegative)
+	case math.MaxInt64:
+		return binaryInfinity(infinityTsPositive)
+	}
+	return time.Unix(pgEpoch.Unix()+usec/1e6, usec%1e6*1e3).UTC(), nil
+}
+
+func binaryInfinity(t time.Time) (time.Time, error) {
+	if !infinityTsEnabled {
+		return time.Time{}, errors.New("pq: cannot scan an infinite range bound into time.Time; see EnableInfinityTs")
+	}
+	return t, nil
+}
+
+// unmarshalRangeBound sets dst from the binary format of a bound. The
+// length tells apart int4 from int8, and date from timestamp.
+func unmarshalRangeBound(dst interface{}, b []byte) error {
+	var n int64
+	switch len(b) {
+	case 4:
+		n = int64(int32(binary.BigEndian.Uint32(b)))
+	case 8:
+		n = int64(binary.BigEndian.Uint64(b))
+	}
+
+	switch d := dst.(type) {
+	case *int64, *int32, *int:
+		if len(b) != 4 && len(b) != 8 {
+			return fmt.Errorf("pq: invalid binary integer bound of length %d", len(b))
+		}
+		switch d := d.(type) {
+		case *int64:
+			*d = n
+		case *int32:
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return fmt.Errorf("pq: range bound %d out of range for int32", n)
+			}
+			*d = int32(n)
+		case *int:
+			*d = int(n)
+		}
+	case *float64:
+		if len(b) != 8 {
+			return fmt.Errorf("pq: invalid binary float8 bound of length %d", len(b))
+		}
+		*d = math.Float64frombits(uint64(n))
+	case *time.Time:
+		var err error
+		switch len(b) {
+		case 4:
+			*d, err = unmarshalDate(n)
+		case 8:
+			*d, err = unmarshalTimestamp(n)
+		default:
+			return fmt.Errorf("pq: invalid binary time bound of length %d", len(b))
+		}
+		if err != nil {
+			return err
+		}
+	case *string:
+		*d = string(b)
+	case *[]byte:
+		*d = append([]byte(nil), b...)
+	case encoding.BinaryUnmarshaler:
+		return d.UnmarshalBinary(b)
+	default:
+		return fmt.Errorf("pq: unsupported range bound type %T", dst)
+	}
+	return nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
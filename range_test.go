@@ -0,0 +1,312 @@
+package pq
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRangeScan(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want Range[int64]
+		out  string
+	}{
+		{"[1,5)", Range[int64]{Lower: 1, Upper: 5, LowerInc: true}, `["1","5")`},
+		{"(1,5]", Range[int64]{Lower: 1, Upper: 5, UpperInc: true}, `("1","5"]`},
+		{"(,5)", Range[int64]{Upper: 5, LowerInf: true}, `(,"5")`},
+		{"[1,)", Range[int64]{Lower: 1, LowerInc: true, UpperInf: true}, `["1",)`},
+		{"(,)", Range[int64]{LowerInf: true, UpperInf: true}, `(,)`},
+		{"empty", Range[int64]{Empty: true}, "empty"},
+		{` ["1","5") `, Range[int64]{Lower: 1, Upper: 5, LowerInc: true}, `["1","5")`},
+	} {
+		var r Range[int64]
+		if err := r.Scan([]byte(c.in)); err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if r != c.want {
+			t.Errorf("%q: expected %+v, got %+v", c.in, c.want, r)
+		}
+		if v, _ := r.Value(); v != c.out {
+			t.Errorf("%q: expected %s, got %v", c.in, c.out, v)
+		}
+	}
+
+	for _, s := range []string{"", "[1,5", "1,5)", "[1 5)", "[a,5)", "[1,5) x", "emptyish"} {
+		var r Range[int64]
+		if err := r.Scan(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+	r := Range[int64]{Lower: 1, Upper: 2}
+	if err := r.Scan(nil); err != nil || r != (Range[int64]{}) {
+		t.Errorf("NULL: expected the zero Range, got %+v, %v", r, err)
+	}
+}
+
+func TestRangeBoundTypes(t *testing.T) {
+	var ts Range[time.Time]
+	if err := ts.Scan(`["2020-01-01 10:00:00","2020-01-02 00:00:00.5")`); err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Lower.Equal(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)) || ts.Upper.Nanosecond() != 5e8 {
+		t.Errorf("unexpected %+v", ts)
+	}
+
+	var tstz Range[time.Time]
+	if err := tstz.Scan(`["2020-01-01 10:00:00+02",)`); err != nil {
+		t.Fatal(err)
+	}
+	if !tstz.Lower.Equal(time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected %v", tstz.Lower)
+	}
+
+	var d Range[time.Time]
+	if err := d.Scan(`[2020-01-01,2020-02-01)`); err != nil {
+		t.Fatal(err)
+	}
+	if d.Upper.Month() != time.February {
+		t.Errorf("unexpected %v", d.Upper)
+	}
+
+	var n Range[Numeric]
+	if err := n.Scan(`[1.50,"2.25"]`); err != nil {
+		t.Fatal(err)
+	}
+	if n.Lower.String() != "1.50" || n.Upper.String() != "2.25" {
+		t.Errorf("unexpected %v", n)
+	}
+	if v, _ := n.Value(); v != `["1.50","2.25"]` {
+		t.Errorf("unexpected %v", v)
+	}
+
+	var s Range[string]
+	if err := s.Scan(`["a\"b","c""d")`); err != nil {
+		t.Fatal(err)
+	}
+	if s.Lower != `a"b` || s.Upper != `c"d` {
+		t.Errorf("unexpected %+v", s)
+	}
+	if v, _ := s.Value(); v != `["a\"b","c\"d")` {
+		t.Errorf("unexpected %v", v)
+	}
+
+	var bad Range[struct{}]
+	if err := bad.Scan("[1,2)"); err == nil {
+		t.Error("expected error for unsupported bound type")
+	}
+}
+
+func TestRangeBinary(t *testing.T) {
+	for _, r := range []Range[int64]{
+		{Lower: 1, Upper: 5, LowerInc: true},
+		{Upper: -3, LowerInf: true, UpperInc: true},
+		{LowerInf: true, UpperInf: true},
+		{Empty: true},
+	} {
+		b, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Range[int64]
+		if err := got.Scan(b); err != nil {
+			t.Fatalf("%+v: %v", r, err)
+		}
+		if got != r {
+			t.Errorf("expected %+v, got %+v", r, got)
+		}
+	}
+
+	// int4range bounds are four bytes long.
+	var r Range[int32]
+	if err := r.UnmarshalBinary([]byte{rangeLowerInc, 0, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 4, 0, 0, 0, 5}); err != nil {
+		t.Fatal(err)
+	}
+	if r != (Range[int32]{Lower: 1, Upper: 5, LowerInc: true}) {
+		t.Errorf("unexpected %+v", r)
+	}
+	if err := r.UnmarshalBinary([]byte{rangeLowerInc, 0, 0, 0, 4, 0, 0}); err == nil {
+		t.Error("expected error for truncated data")
+	}
+
+	want := time.Date(2024, 2, 29, 12, 30, 0, 0, time.UTC)
+	b, _ := Range[time.Time]{Lower: want, UpperInf: true}.MarshalBinary()
+	var tr Range[time.Time]
+	if err := tr.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.Lower.Equal(want) || !tr.UpperInf {
+		t.Errorf("unexpected %+v", tr)
+	}
+
+	// Beyond the 292 years a time.Duration spans from 2000.
+	for _, want := range []time.Time{
+		time.Date(2500, 6, 1, 1, 2, 3, 4000, time.UTC),
+		time.Date(1200, 6, 1, 1, 2, 3, 4000, time.UTC),
+	} {
+		b, _ := Range[time.Time]{Lower: want, Upper: want, LowerInc: true, UpperInc: true}.MarshalBinary()
+		if err := tr.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if !tr.Lower.Equal(want) || !tr.Upper.Equal(want) {
+			t.Errorf("expected %v, got %+v", want, tr)
+		}
+	}
+}
+
+func TestRangeBinaryType(t *testing.T) {
+	ir := Range[int]{Lower: 1, Upper: 5, LowerInc: true}
+	b, err := ir.MarshalBinaryType("int4range")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{rangeLowerInc, 0, 0, 0, 4, 0, 0, 0, 1, 0, 0, 0, 4, 0, 0, 0, 5}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("int4range: expected %v, got %v", want, b)
+	}
+	if b, _ := ir.MarshalBinaryType("int8range"); len(b) != 1+2*(4+8) {
+		t.Errorf("int8range: unexpected %v", b)
+	}
+	if _, err := (Range[int]{Lower: 1 << 40, UpperInf: true}).MarshalBinaryType("int4range"); err == nil {
+		t.Error("expected error for an int4 bound out of range")
+	}
+
+	day := time.Date(2000, 1, 3, 15, 0, 0, 0, time.UTC)
+	dr := Range[time.Time]{Lower: day, LowerInc: true, UpperInf: true}
+	b, err = Multirange[time.Time]{dr}.MarshalBinaryType("datemultirange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Multirange[time.Time]
+	if err := m.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || !m[0].Lower.Equal(time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("daterange: unexpected %+v", m)
+	}
+	if b, _ := dr.MarshalBinaryType("daterange"); len(b) != 1+4+4 {
+		t.Errorf("daterange: unexpected %v", b)
+	}
+
+	if _, err := dr.MarshalBinaryType("int4range"); err == nil {
+		t.Error("expected error for a time bound of an int4range")
+	}
+	if _, err := dr.MarshalBinaryType("nosuchrange"); err == nil {
+		t.Error("expected error for an unknown range type")
+	}
+}
+
+func TestRangeBinaryInfinity(t *testing.T) {
+	defer disableInfinityTs()
+	neg := time.Date(-1, 1, 1, 0, 0, 0, 0, time.UTC)
+	pos := time.Date(300000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	inf := Range[time.Time]{Lower: neg, Upper: pos}
+	if _, err := inf.MarshalBinary(); err == nil {
+		t.Error("expected error for a timestamp out of range")
+	}
+
+	EnableInfinityTs(neg, pos)
+	for _, typ := range []string{"tsrange", "daterange"} {
+		b, err := inf.MarshalBinaryType(typ)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		var got Range[time.Time]
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		if !got.Lower.Equal(neg) || !got.Upper.Equal(pos) {
+			t.Errorf("%s: unexpected %+v", typ, got)
+		}
+
+		disableInfinityTs()
+		if err := got.UnmarshalBinary(b); err == nil {
+			t.Errorf("%s: expected error without EnableInfinityTs", typ)
+		}
+		EnableInfinityTs(neg, pos)
+	}
+}
+
+func TestMultirange(t *testing.T) {
+	var m Multirange[int64]
+	if err := m.Scan([]byte("{[1,3), [5,7),(,0]}")); err != nil {
+		t.Fatal(err)
+	}
+	want := Multirange[int64]{
+		{Lower: 1, Upper: 3, LowerInc: true},
+		{Lower: 5, Upper: 7, LowerInc: true},
+		{Upper: 0, LowerInf: true, UpperInc: true},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("expected %+v, got %+v", want, m)
+	}
+	if v, _ := m.Value(); v != `{["1","3"),["5","7"),(,"0"]}` {
+		t.Errorf("unexpected %v", v)
+	}
+
+	b, _ := m.MarshalBinary()
+	var got Multirange[int64]
+	if err := got.Scan(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if err := m.Scan("{}"); err != nil || m == nil || len(m) != 0 {
+		t.Errorf("expected empty multirange, got %v, %v", m, err)
+	}
+	if err := m.Scan(nil); err != nil || m != nil {
+		t.Errorf("expected NULL, got %v, %v", m, err)
+	}
+	for _, s := range []string{"", "[1,2)", "{[1,2) [3,4)}", "{[1,2),}"} {
+		if err := m.Scan(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestRangeRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	in := Range[int64]{Lower: 1, Upper: 10, LowerInc: true, UpperInc: true}
+	var out Range[int64]
+	if err := db.QueryRow("SELECT $1::int8range", in).Scan(&out); err != nil {
+		t.Fatal(err)
+	}
+	// The server normalizes discrete ranges to [lower,upper).
+	if out != (Range[int64]{Lower: 1, Upper: 11, LowerInc: true}) {
+		t.Errorf("unexpected %+v", out)
+	}
+
+	var d Range[time.Time]
+	if err := db.QueryRow("SELECT daterange('2020-01-01', '2020-02-01')").Scan(&d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Lower.Day() != 1 || d.Upper.Month() != time.February {
+		t.Errorf("unexpected %+v", d)
+	}
+
+	var n Range[Numeric]
+	if err := db.QueryRow("SELECT numrange(1.5, NULL)").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Lower.String() != "1.5" || !n.UpperInf {
+		t.Errorf("unexpected %+v", n)
+	}
+
+	var m Multirange[int64]
+	err := db.QueryRow("SELECT $1::int4multirange", Multirange[int64]{{Lower: 1, Upper: 3, LowerInc: true}}).Scan(&m)
+	if err != nil {
+		if ErrorCode(err) == "42704" { // undefined_object: before 14
+			t.Skip("multiranges are not supported by this server")
+		}
+		t.Fatal(err)
+	}
+	if len(m) != 1 || m[0].Lower != 1 || m[0].Upper != 3 {
+		t.Errorf("unexpected %+v", m)
+	}
+}
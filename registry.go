@@ -0,0 +1,313 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// A Decoder decodes a value of a registered type from the text format
+// the server sends it in. The value it returns is what the column
+// scans from, so it should be one of the driver.Value types or a type
+// that the destination's Scan method accepts.
+type Decoder func(src []byte) (interface{}, error)
+
+// An Encoder encodes a parameter of a registered type in the text
+// format the server reads it in. It is given the parameter as passed to
+// Exec or Query, or the result of its Value method if it is a
+// driver.Valuer.
+type Encoder func(v interface{}) ([]byte, error)
+
+// registeredType is a type registered with RegisterType or
+// RegisterComposite. Types registered by name have no oid, and
+// composites no attributes, until a connection resolves them.
+type registeredType struct {
+	name string
+	oid  oid
+	dec  Decoder
+	enc  Encoder
+
+	composite bool
+	attNames  []string
+	attTypes  []oid
+}
+
+func (r registeredType) String() string {
+	if r.name != "" {
+		return r.name
+	}
+	return fmt.Sprintf("type %d", r.oid)
+}
+
+var (
+	typeRegistryMu sync.RWMutex
+	typeRegistry   []registeredType
+
+	// typeRegistryGen counts changes to typeRegistry, so that
+	// connections know when to resolve the registered types again.
+	typeRegistryGen int
+)
+
+// RegisterType registers a decoder and an encoder for a type that pq
+// does not otherwise know, such as an extension type like citext,
+// ltree or hstore, an enum or a domain. typ is either the type's name,
+// which may be schema-qualified and is looked up in pg_type by each
+// connection, or its OID as an int or uint32; array types are named
+// like "hstore[]". Either of dec and enc may be nil to leave values of
+// the type decoded or encoded as before. Registering a type again
+// replaces the earlier registration.
+//
+// Each connection resolves the registered names once, before the
+// first statement it prepares or runs after a registration, and caches
+// the result. A name that does not exist at that time is not looked up
+// again; a lookup that fails is retried by the next statement. The
+// server describes columns of a domain with the OID of the base type,
+// so only the encoder of a domain is ever used.
+//
+// RegisterType is meant to be called before the driver is used, as
+// from an init function. It panics if typ is neither a valid type name
+// nor an OID, or if both dec and enc are nil. Names are checked here
+// because they are looked up inside whatever transaction the
+// connection is in, which a malformed name would abort.
+func RegisterType(typ interface{}, dec Decoder, enc Encoder) {
+	rt := registeredType{dec: dec, enc: enc}
+	switch v := typ.(type) {
+	case string:
+		if !validTypeName(v) {
+			panic(fmt.Sprintf("pq: RegisterType: invalid type name %q", v))
+		}
+		rt.name = v
+	case int:
+		rt.oid = oid(v)
+	case uint32:
+		rt.oid = oid(v)
+	default:
+		panic(fmt.Sprintf("pq: RegisterType: invalid type %T", typ))
+	}
+	if rt.name == "" && rt.oid == 0 {
+		panic("pq: RegisterType: zero OID")
+	}
+	if dec == nil && enc == nil {
+		panic("pq: RegisterType: no decoder or encoder")
+	}
+	registerType(rt)
+}
+
+// RegisterComposite registers the composite type with the given name,
+// which may be schema-qualified, so that each connection looks up its
+// attributes as RegisterType describes for names. Values of the type
+// are then decoded as a Composite with the attribute names and each
+// field decoded by its attribute's type, and a CompositeStruct sent as
+// a parameter of the type has its fields matched to the attributes by
+// name. A name that is not a composite type is ignored.
+//
+// Without registration, composite and record values are returned as
+// text, which Composite and CompositeStruct can scan by field order.
+func RegisterComposite(name string) {
+	if !validTypeName(name) {
+		panic(fmt.Sprintf("pq: RegisterComposite: invalid type name %q", name))
+	}
+	registerType(registeredType{name: name, composite: true})
+}
+
+// validTypeName reports whether name is a type name that to_regtype
+// can look up without raising an error: an identifier, quoted or not,
+// optionally qualified by a schema and followed by "[]". Unqualified
+// names may be several words, as in "double precision".
+func validTypeName(name string) bool {
+	for strings.HasSuffix(name, "[]") {
+		name = name[:len(name)-2]
+	}
+
+	parts := 0
+	for {
+		parts++
+		var words int
+		if strings.HasPrefix(name, `"`) {
+			i := 1
+			for ; i < len(name); i++ {
+				if name[i] == '"' {
+					if i+1 < len(name) && name[i+1] == '"' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			if i >= len(name) || i == 1 {
+				return false
+			}
+			name, words = name[i+1:], 1
+		} else {
+			for {
+				n := identLen(name)
+				if n == 0 {
+					return false
+				}
+				name, words = name[n:], words+1
+				if !strings.HasPrefix(name, " ") {
+					break
+				}
+				name = name[1:]
+			}
+		}
+
+		switch {
+		case name == "":
+			return parts == 1 || words == 1
+		case name[0] != '.' || parts == 2 || words > 1:
+			return false
+		}
+		name = name[1:]
+	}
+}
+
+// identLen returns the length of the unquoted identifier that s starts
+// with, or 0 if it does not start with one.
+func identLen(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+		case i > 0 && (c == '$' || c >= '0' && c <= '9'):
+		default:
+			return i
+		}
+	}
+	return len(s)
+}
+
+func registerType(rt registeredType) {
+	typeRegistryMu.Lock()
+	defer typeRegistryMu.Unlock()
+	typeRegistryGen++
+	for i, r := range typeRegistry {
+		if r.name == rt.name && r.oid == rt.oid {
+			typeRegistry[i] = rt
+			return
+		}
+	}
+	typeRegistry = append(typeRegistry, rt)
+}
+
+// registeredEncoders reports whether any registered type has an
+// encoder, in which case CheckNamedValue lets values through that only
+// an encoder may know how to send.
+func registeredEncoders() bool {
+	typeRegistryMu.RLock()
+	defer typeRegistryMu.RUnlock()
+	for _, r := range typeRegistry {
+		if r.enc != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTypes brings the connection's map of registered types up to
+// date with the registry, looking up the OIDs of the types registered
+// by name. It is called before a statement is prepared or run, and
+// does nothing in a failed transaction, where no query can run. If a
+// lookup fails, the next statement tries again.
+func (cn *conn) resolveTypes() {
+	typeRegistryMu.RLock()
+	gen, reg := typeRegistryGen, append([]registeredType(nil), typeRegistry...)
+	typeRegistryMu.RUnlock()
+
+	if gen == cn.typesGen || cn.resolvingTypes || cn.txnStatus == txnStatusInFailedTransaction {
+		return
+	}
+	// The lookup queries come back here.
+	cn.resolvingTypes = true
+	defer func() { cn.resolvingTypes = false }()
+
+	var names [][]byte
+	for _, r := range reg {
+		if r.name != "" {
+			names = append(names, []byte(r.name))
+		}
+	}
+	oids := make(map[string]oid)
+	if len(names) > 0 {
+		oids = cn.lookupTypes(names)
+	}
+
+	types := make(map[oid]registeredType)
+	for _, r := range reg {
+		if r.name != "" {
+			r.oid = oids[r.name]
+			if r.oid == 0 {
+				continue
+			}
+		}
+		if r.composite {
+			r.attNames, r.attTypes = cn.lookupAttributes(r.oid)
+			if r.attNames == nil {
+				continue
+			}
+		}
+		types[r.oid] = r
+	}
+	cn.types, cn.typesGen = types, gen
+}
+
+// lookupTypes returns the OIDs of the named types that exist.
+func (cn *conn) lookupTypes(names [][]byte) map[string]oid {
+	oids := make(map[string]oid)
+	cn.lookup("SELECT n, to_regtype(n)::oid::int8 FROM unnest($1::text[]) n",
+		string(appendArray(nil, names, ',')), func(row []driver.Value) {
+			if n, ok := row[1].(int64); ok {
+				oids[string(row[0].([]byte))] = oid(n)
+			}
+		})
+	return oids
+}
+
+// lookupAttributes returns the attribute names and types of the
+// composite type typ, or nil if typ is not a composite type.
+func (cn *conn) lookupAttributes(typ oid) (names []string, typs []oid) {
+	cn.lookup(`SELECT a.attname, a.atttypid::int8
+		FROM pg_type t JOIN pg_attribute a ON a.attrelid = t.typrelid
+		WHERE t.oid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, int64(typ), func(row []driver.Value) {
+		names = append(names, string(row[0].([]byte)))
+		typs = append(typs, oid(row[1].(int64)))
+	})
+	return names, typs
+}
+
+// lookup runs the two-column query q with the argument arg, calling fn
+// for each row.
+func (cn *conn) lookup(q string, arg driver.Value, fn func(row []driver.Value)) {
+	st, err := cn.prepareTo(q, "")
+	if err != nil {
+		panic(err)
+	}
+	rs, err := st.Query([]driver.Value{arg})
+	if err != nil {
+		panic(err)
+	}
+	defer rs.Close()
+
+	row := make([]driver.Value, 2)
+	for {
+		err := rs.Next(row)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+		fn(row)
+	}
+}
+
+// clearTypeRegistry removes every registered type, for tests.
+func clearTypeRegistry() {
+	typeRegistryMu.Lock()
+	defer typeRegistryMu.Unlock()
+	typeRegistryGen++
+	typeRegistry = nil
+}
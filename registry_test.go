@@ -0,0 +1,211 @@
+package pq
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mood string
+
+func decodeMood(src []byte) (interface{}, error) {
+	return "mood:" + string(src), nil
+}
+
+func encodeMood(v interface{}) ([]byte, error) {
+	m, ok := v.(mood)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T", v)
+	}
+	return []byte(strings.ToLower(string(m))), nil
+}
+
+func TestRegisterType(t *testing.T) {
+	defer clearTypeRegistry()
+
+	for _, typ := range []interface{}{"", 0, uint32(0), int64(5), nil} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%#v: expected panic", typ)
+				}
+			}()
+			RegisterType(typ, decodeMood, nil)
+		}()
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic without a decoder or encoder")
+			}
+		}()
+		RegisterType("mood", nil, nil)
+	}()
+
+	if registeredEncoders() {
+		t.Fatal("expected no encoders")
+	}
+	RegisterType(16385, decodeMood, nil)
+	RegisterType(uint32(16385), decodeMood, encodeMood)
+	if len(typeRegistry) != 1 || !registeredEncoders() {
+		t.Fatalf("expected one registration with an encoder, got %v", typeRegistry)
+	}
+
+	// Types registered by OID need no lookup.
+	cn := &conn{}
+	cn.resolveTypes()
+	if v := cn.decode([]byte("happy"), 16385); v != "mood:happy" {
+		t.Errorf("unexpected %v", v)
+	}
+	if b := cn.encode(mood("SAD"), 16385); !bytes.Equal(b, []byte("sad")) {
+		t.Errorf("unexpected %s", b)
+	}
+	if v := cn.decode([]byte("1"), t_int4); v != int64(1) {
+		t.Errorf("unexpected %v", v)
+	}
+
+	err := func() (err error) {
+		defer errRecover(&err)
+		cn.encode("sad", 16385)
+		return nil
+	}()
+	if err == nil || !strings.Contains(err.Error(), "type 16385") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// A value only an encoder knows is let through.
+	nv := driver.NamedValue{Value: mood("OK")}
+	if err := cn.CheckNamedValue(&nv); err != nil || nv.Value != mood("OK") {
+		t.Errorf("unexpected %#v, %v", nv.Value, err)
+	}
+	if b := cn.encode(cn.convert(mood("OK"), t_text), t_text); !bytes.Equal(b, []byte("OK")) {
+		t.Errorf("unexpected %s", b)
+	}
+
+	// Other values let through keep the encoding they have without an
+	// encoder, and nil pointers are NULL.
+	var u [16]byte
+	u[15] = 1
+	var s *string
+	for _, c := range []struct {
+		x    interface{}
+		typ  oid
+		want interface{}
+	}{
+		{u, t_uuid, "00000000-0000-0000-0000-000000000001"},
+		{90 * time.Minute, t_interval, "PT1H30M"},
+		{s, t_text, nil},
+	} {
+		nv := driver.NamedValue{Value: c.x}
+		if err := cn.CheckNamedValue(&nv); err != nil {
+			t.Errorf("%#v: %v", c.x, err)
+			continue
+		}
+		var got interface{}
+		if x := cn.convert(nv.Value, c.typ); x != nil {
+			got = string(cn.encode(x, c.typ))
+		}
+		if got != c.want {
+			t.Errorf("%#v: expected %v, got %v", c.x, c.want, got)
+		}
+	}
+	nv = driver.NamedValue{Value: int64(1)}
+	if err := cn.CheckNamedValue(&nv); err != driver.ErrSkip {
+		t.Errorf("expected ErrSkip, got %v", err)
+	}
+
+	clearTypeRegistry()
+	cn.resolveTypes()
+	if v := cn.decode([]byte("happy"), 16385); string(v.([]byte)) != "happy" {
+		t.Errorf("unexpected %v", v)
+	}
+}
+
+func TestValidTypeName(t *testing.T) {
+	for _, name := range []string{
+		"mood", "public.mood", "hstore[]", `"My Type"`, `app."my ""type"""[]`,
+		"double precision", "timestamp with time zone[]", "_int4", "é$1",
+	} {
+		if !validTypeName(name) {
+			t.Errorf("%q: expected valid", name)
+		}
+	}
+	for _, name := range []string{
+		"", "1mood", "mood[", "a.b.c", "public.double precision", "my schema.mood",
+		`""`, `"unterminated`, `"a"b`, "mood ", "a..b", "varchar(10)", "mood;drop",
+	} {
+		if validTypeName(name) {
+			t.Errorf("%q: expected invalid", name)
+		}
+	}
+}
+
+func TestResolveTypesRetry(t *testing.T) {
+	defer clearTypeRegistry()
+	RegisterType("mood", decodeMood, nil)
+
+	client, server := net.Pipe()
+	server.Close()
+	cn := &conn{c: client, buf: bufio.NewReader(client)}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the lookup to fail")
+			}
+		}()
+		cn.resolveTypes()
+	}()
+	if cn.typesGen == typeRegistryGen || cn.resolvingTypes {
+		t.Errorf("expected the lookup to be retried, got generation %d", cn.typesGen)
+	}
+}
+
+func TestRegisterTypeRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+	defer clearTypeRegistry()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("CREATE TYPE pq_mood AS ENUM ('happy', 'sad')"); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterType("pq_mood", decodeMood, encodeMood)
+	RegisterType("pq_mood[]", func(src []byte) (interface{}, error) {
+		return nil, errors.New("no arrays")
+	}, nil)
+	RegisterType("pq_no_such_type", decodeMood, nil)
+
+	var s string
+	if err := tx.QueryRow("SELECT $1::pq_mood", mood("SAD")).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "mood:sad" {
+		t.Errorf("unexpected %s", s)
+	}
+
+	rows, err := tx.Query("SELECT 'happy'::pq_mood")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols, _ := rows.ColumnTypes()
+	if name := cols[0].DatabaseTypeName(); name != "PQ_MOOD" {
+		t.Errorf("expected PQ_MOOD, got %q", name)
+	}
+	rows.Close()
+
+	if err := tx.QueryRow("SELECT ARRAY['happy']::pq_mood[]").Scan(&s); err == nil || !strings.Contains(err.Error(), "no arrays") {
+		t.Errorf("expected the array decoder's error, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrPreparedTxDisabled = errors.New("pq: prepared transactions are disabled; set max_prepared_transactions above zero on the server")
+
+// maxGIDLen is the longest global transaction identifier the server
+// accepts, in bytes.
+const maxGIDLen = 199
+
+// PrepareTx prepares tx for two-phase commit under the global
+// transaction identifier gid. Once prepared, the transaction is no
+// longer tied to tx's connection: finish it later with CommitPrepared
+// or RollbackPrepared, from any session of the same database. tx is
+// done when PrepareTx returns, whether or not it succeeded; if
+// preparing fails the transaction has been rolled back.
+//
+// If the server has max_prepared_transactions set to 0 the returned
+// error wraps ErrPreparedTxDisabled.
+func PrepareTx(ctx context.Context, tx *sql.Tx, gid string) error {
+	if err := checkGID(gid); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "PREPARE TRANSACTION "+quoteLiteral(gid))
+
+	// Whatever happened, the session is no longer in a transaction;
+	// this just hands the connection back to the pool.
+	tx.Rollback()
+
+	if ErrorCode(err) == ErrCodeObjectNotInPrerequisiteState {
+		return fmt.Errorf("%w: %w", ErrPreparedTxDisabled, err)
+	}
+	return err
+}
+
+// CommitPrepared commits the transaction prepared under gid.
+func CommitPrepared(ctx context.Context, db *sql.DB, gid string) error {
+	return finishPrepared(ctx, db, "COMMIT PREPARED ", gid)
+}
+
+// RollbackPrepared rolls back the transaction prepared under gid.
+func RollbackPrepared(ctx context.Context, db *sql.DB, gid string) error {
+	return finishPrepared(ctx, db, "ROLLBACK PREPARED ", gid)
+}
+
+func finishPrepared(ctx context.Context, db *sql.DB, cmd, gid string) error {
+	if err := checkGID(gid); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(ctx, cmd+quoteLiteral(gid))
+	return err
+}
+
+func checkGID(gid string) error {
+	switch {
+	case gid == "":
+		return errors.New("pq: empty global transaction identifier")
+	case len(gid) > maxGIDLen:
+		return fmt.Errorf("pq: global transaction identifier longer than %d bytes", maxGIDLen)
+	}
+	return nil
+}
+
+// PreparedTx describes a transaction prepared for two-phase commit, as
+// listed in pg_prepared_xacts.
+type PreparedTx struct {
+	GID         string
+	Transaction string // transaction ID (xid)
+	Prepared    time.Time
+	Owner       string
+	Database    string
+}
+
+// PreparedTransactions lists the transactions that are prepared in the
+// current database and still awaiting CommitPrepared or
+// RollbackPrepared, oldest first. Transactions left in doubt by a
+// crashed coordinator can be found and resolved with it.
+func PreparedTransactions(ctx context.Context, db *sql.DB) ([]PreparedTx, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT gid, transaction::text, prepared, owner, database
+		FROM pg_prepared_xacts
+		WHERE database = current_database()
+		ORDER BY prepared`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []PreparedTx
+	for rows.Next() {
+		var p PreparedTx
+		err = rows.Scan(&p.GID, &p.Transaction, &p.Prepared, &p.Owner, &p.Database)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, p)
+	}
+
+	return txs, rows.Err()
+}
+
+// quoteLiteral quotes s for use as an SQL string literal, whatever the
+// setting of standard_conforming_strings.
+func quoteLiteral(s string) string {
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+
+	s = strings.Replace(s, `'`, `''`, -1)
+	if strings.Contains(s, `\`) {
+		return ` E'` + strings.Replace(s, `\`, `\\`, -1) + `'`
+	}
+	return `'` + s + `'`
+}
@@ -0,0 +1,79 @@
+package pq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestQuoteLiteral(t *testing.T) {
+	for s, want := range map[string]string{
+		"gid":         `'gid'`,
+		"it's":        `'it''s'`,
+		`back\slash`:  ` E'back\\slash'`,
+		"trunc\x00ed": `'trunc'`,
+	} {
+		if got := quoteLiteral(s); got != want {
+			t.Errorf("%q: expected %s, got %s", s, want, got)
+		}
+	}
+}
+
+func TestCheckGID(t *testing.T) {
+	if err := checkGID("txn-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gid := range []string{"", strings.Repeat("x", 200)} {
+		if err := checkGID(gid); err == nil {
+			t.Errorf("expected error for gid of length %d", len(gid))
+		}
+	}
+}
+
+func TestTwoPhaseCommit(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tx.Exec("SET LOCAL lock_timeout = 1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const gid = "pqgotest-2pc"
+	err = PrepareTx(ctx, tx, gid)
+	if errors.Is(err, ErrPreparedTxDisabled) {
+		t.Skip("max_prepared_transactions is 0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs, err := PreparedTransactions(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, p := range txs {
+		found = found || p.GID == gid
+	}
+	if !found {
+		t.Fatalf("expected %q among prepared transactions %+v", gid, txs)
+	}
+
+	if err = CommitPrepared(ctx, db, gid); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = RollbackPrepared(ctx, db, gid); err == nil {
+		t.Fatal("expected error resolving a finished transaction")
+	}
+}
@@ -0,0 +1,254 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Tx is a transaction that can be nested using savepoints. The
+// outermost Tx wraps an *sql.Tx; Savepoint starts a nested Tx whose
+// Commit and Rollback release or roll back to its savepoint, leaving
+// the enclosing transaction open. This lets functions that each want
+// "a transaction" be composed, with inner units of work rolling back
+// independently:
+//
+//	tx := pq.NewTx(sqltx)
+//	sp, err := tx.Savepoint(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	if err := doWork(sp); err != nil {
+//		sp.Rollback() // tx is still usable
+//	} else {
+//		sp.Commit()
+//	}
+//
+// A Tx and its nested transactions must not be used concurrently.
+type Tx struct {
+	*sql.Tx
+
+	name   string // savepoint name, "" for the outermost transaction
+	parent *Tx
+	child  *Tx
+	done   bool
+}
+
+// NewTx wraps tx so that nested transactions can be started on it.
+func NewTx(tx *sql.Tx) *Tx {
+	return &Tx{Tx: tx}
+}
+
+// savepoints numbers the generated savepoint names. It is shared by
+// all transactions, so that names stay unique however many Tx wrap
+// the same *sql.Tx.
+var savepoints uint64
+
+// Savepoint starts a nested transaction on tx by creating a savepoint
+// with a generated name.
+func (tx *Tx) Savepoint(ctx context.Context) (*Tx, error) {
+	n := atomic.AddUint64(&savepoints, 1)
+	return tx.savepoint(ctx, "pq_savepoint_"+strconv.FormatUint(n, 10))
+}
+
+// Savepoint starts a nested transaction on tx by creating a savepoint
+// with the given name.
+func Savepoint(ctx context.Context, tx *sql.Tx, name string) (*Tx, error) {
+	return NewTx(tx).savepoint(ctx, name)
+}
+
+func (tx *Tx) savepoint(ctx context.Context, name string) (*Tx, error) {
+	if tx.done {
+		return nil, sql.ErrTxDone
+	}
+
+	_, err := tx.ExecContext(ctx, "SAVEPOINT "+quoteIdentifier(name))
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &Tx{Tx: tx.Tx, name: name, parent: tx}
+	tx.child = sp
+	return sp, nil
+}
+
+// Name returns the name of the savepoint backing tx, or "" for the
+// outermost transaction.
+func (tx *Tx) Name() string {
+	return tx.name
+}
+
+// Commit commits the outermost transaction, or releases the savepoint
+// of a nested one. Nested transactions that are still open are
+// committed along with it.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.finish()
+
+	if tx.parent == nil {
+		return tx.Tx.Commit()
+	}
+
+	_, err := tx.Exec("RELEASE SAVEPOINT " + quoteIdentifier(tx.name))
+	return err
+}
+
+// Rollback rolls back the outermost transaction, or undoes everything
+// done since the savepoint of a nested one was created. In the latter
+// case the enclosing transaction stays open, even if an error aborted
+// the nested one.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.finish()
+
+	if tx.parent == nil {
+		return tx.Tx.Rollback()
+	}
+
+	name := quoteIdentifier(tx.name)
+	_, err := tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
+
+// finish marks tx and any nested transactions done, since the server
+// discards inner savepoints along with the outer one.
+func (tx *Tx) finish() {
+	for t := tx; t != nil; t = t.child {
+		t.done = true
+	}
+	if tx.parent != nil && tx.parent.child == tx {
+		tx.parent.child = nil
+	}
+}
+
+// quoteIdentifier quotes s for use as an SQL identifier.
+func quoteIdentifier(s string) string {
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// RetryOptions configures RunInTx.
+type RetryOptions struct {
+	// TxOptions are passed to BeginTx for every attempt.
+	TxOptions sql.TxOptions
+
+	// MaxAttempts caps the number of times the transaction is run.
+	// If zero, 5 is used.
+	MaxAttempts int
+
+	// RetryConnLoss also retries when the connection is lost before
+	// COMMIT is sent. A connection lost during COMMIT is never
+	// retried, since the transaction may have committed.
+	RetryConnLoss bool
+
+	// Backoff returns how long to wait before the given retry, which
+	// counts from 1. If nil, an exponential backoff with jitter
+	// starting at 10ms and capped at 1s is used.
+	Backoff func(retry int) time.Duration
+
+	// OnRetry, if not nil, is called with the error that caused each
+	// retry, e.g. to record metrics.
+	OnRetry func(retry int, err error)
+}
+
+// RunInTx runs fn in a transaction on db and commits it, running the
+// whole transaction again when it fails with a serialization failure
+// or a deadlock, which are expected under SERIALIZABLE isolation. fn
+// may therefore be called several times and should have no effects
+// outside the transaction. If fn returns an error the transaction is
+// rolled back and, unless the error is retryable, RunInTx returns it.
+// opts may be nil.
+func RunInTx(ctx context.Context, db *sql.DB, opts *RetryOptions, fn func(*sql.Tx) error) error {
+	if opts == nil {
+		opts = &RetryOptions{}
+	}
+
+	max := opts.MaxAttempts
+	if max <= 0 {
+		max = 5
+	}
+
+	backoff := opts.Backoff
+	if backoff == nil {
+		backoff = defaultBackoff
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var committing bool
+		committing, err = runTx(ctx, db, &opts.TxOptions, fn)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= max || !retryable(err, committing, opts.RetryConnLoss) {
+			return err
+		}
+
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt, err)
+		}
+
+		t := time.NewTimer(backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// runTx runs a single attempt of RunInTx, reporting whether the error,
+// if any, came from COMMIT.
+func runTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(*sql.Tx) error) (committing bool, err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// retryable reports whether a transaction that failed with err may
+// safely be run again.
+func retryable(err error, committing, connLoss bool) bool {
+	switch ErrorCode(err) {
+	case ErrCodeSerializationFailure, ErrCodeDeadlockDetected:
+		// The server rolled back, even if this came from COMMIT.
+		return true
+	}
+
+	return connLoss && !committing && errors.Is(err, driver.ErrBadConn)
+}
+
+func defaultBackoff(retry int) time.Duration {
+	d := time.Second
+	if retry <= 7 {
+		d = 10 * time.Millisecond << uint(retry-1)
+	}
+	// Full jitter, so that conflicting transactions spread out.
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
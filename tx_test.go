@@ -0,0 +1,165 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	for s, want := range map[string]string{
+		"sp":          `"sp"`,
+		`we"ird`:      `"we""ird"`,
+		"trunc\x00ed": `"trunc"`,
+	} {
+		if got := quoteIdentifier(s); got != want {
+			t.Errorf("%q: expected %s, got %s", s, want, got)
+		}
+	}
+}
+
+func TestNestedTx(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	sqltx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewTx(sqltx)
+	defer tx.Rollback()
+
+	_, err = tx.Exec("CREATE TEMP TABLE temp (a int)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sp1, err := tx.Savepoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sp1.Exec("INSERT INTO temp VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	sp2, err := sp1.Savepoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp1.Name() == sp2.Name() {
+		t.Fatalf("expected distinct savepoint names, got %q twice", sp1.Name())
+	}
+	other, err := NewTx(sqltx).Savepoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Name() == sp1.Name() || other.Name() == sp2.Name() {
+		t.Fatalf("expected a savepoint name distinct from %q and %q, got %q", sp1.Name(), sp2.Name(), other.Name())
+	}
+	if err = other.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An error inside the nested transaction must not doom the
+	// enclosing ones once it has been rolled back.
+	if _, err = sp2.Exec("INSERT INTO temp VALUES ('x')"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = sp2.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err = sp2.Commit(); err != sql.ErrTxDone {
+		t.Fatalf("expected sql.ErrTxDone, got %v", err)
+	}
+
+	if err = sp1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err = tx.QueryRow("SELECT count(*) FROM temp").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 row, got %d", n)
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	serialization := &pgError{c: map[byte]string{'C': ErrCodeSerializationFailure}}
+	deadlock := &pgError{c: map[byte]string{'C': ErrCodeDeadlockDetected}}
+	unique := &pgError{c: map[byte]string{'C': "23505"}}
+
+	tests := []struct {
+		err        error
+		committing bool
+		connLoss   bool
+		want       bool
+	}{
+		{serialization, false, false, true},
+		{serialization, true, false, true},
+		{fmt.Errorf("wrapped: %w", deadlock), false, false, true},
+		{unique, false, true, false},
+		{driver.ErrBadConn, false, false, false},
+		{driver.ErrBadConn, false, true, true},
+		{driver.ErrBadConn, true, true, false},
+	}
+
+	for i, test := range tests {
+		if got := retryable(test.err, test.committing, test.connLoss); got != test.want {
+			t.Errorf("%d: expected %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	for retry := 1; retry < 100; retry++ {
+		if d := defaultBackoff(retry); d <= 0 || d > time.Second {
+			t.Fatalf("retry %d: backoff %v out of range", retry, d)
+		}
+	}
+}
+
+func TestRunInTx(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	var attempts, retries int
+	opts := &RetryOptions{
+		TxOptions: sql.TxOptions{Isolation: sql.LevelSerializable},
+		OnRetry:   func(int, error) { retries++ },
+	}
+	err := RunInTx(context.Background(), db, opts, func(tx *sql.Tx) error {
+		attempts++
+		if attempts < 3 {
+			return &pgError{c: map[byte]string{'C': ErrCodeSerializationFailure}}
+		}
+		var n int
+		return tx.QueryRow("SELECT 1").Scan(&n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 || retries != 2 {
+		t.Fatalf("expected 3 attempts and 2 retries, got %d and %d", attempts, retries)
+	}
+
+	opts.MaxAttempts = 2
+	attempts = 0
+	err = RunInTx(context.Background(), db, opts, func(tx *sql.Tx) error {
+		attempts++
+		return &pgError{c: map[byte]string{'C': ErrCodeDeadlockDetected}}
+	})
+	if ErrorCode(err) != ErrCodeDeadlockDetected || attempts != 2 {
+		t.Fatalf("expected deadlock after 2 attempts, got %v after %d", err, attempts)
+	}
+}
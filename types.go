@@ -22,8 +22,10 @@ const (
 	t_pg_attribute                              = 75
 	t_pg_proc                                   = 81
 	t_pg_class                                  = 83
+	t_json                                      = 114
 	t_xml                                       = 142
 	t__xml                                      = 143
+	t__json                                     = 199
 	t_pg_node_tree                              = 194
 	t_smgr                                      = 210
 	t_point                                     = 600
@@ -44,6 +46,7 @@ const (
 	t_money                                     = 790
 	t__money                                    = 791
 	t_macaddr                                   = 829
+	t_macaddr8                                  = 774
 	t_inet                                      = 869
 	t_cidr                                      = 650
 	t__bool                                     = 1000
@@ -76,6 +79,7 @@ const (
 	t_aclitem                                   = 1033
 	t__aclitem                                  = 1034
 	t__macaddr                                  = 1040
+	t__macaddr8                                 = 775
 	t__inet                                     = 1041
 	t__cidr                                     = 651
 	t__cstring                                  = 1263
@@ -118,6 +122,8 @@ const (
 	t_tsquery                                   = 3615
 	t_regconfig                                 = 3734
 	t_regdictionary                             = 3769
+	t_jsonb                                     = 3802
+	t__jsonb                                    = 3807
 	t__tsvector                                 = 3643
 	t__gtsvector                                = 3644
 	t__tsquery                                  = 3645
@@ -139,6 +145,24 @@ const (
 	t_anynonarray                               = 2776
 	t_anyenum                                   = 3500
 	t_fdw_handler                               = 3115
+	t_int4range                                 = 3904
+	t__int4range                                = 3905
+	t_numrange                                  = 3906
+	t__numrange                                 = 3907
+	t_tsrange                                   = 3908
+	t__tsrange                                  = 3909
+	t_tstzrange                                 = 3910
+	t__tstzrange                                = 3911
+	t_daterange                                 = 3912
+	t__daterange                                = 3913
+	t_int8range                                 = 3926
+	t__int8range                                = 3927
+	t_int4multirange                            = 4451
+	t_nummultirange                             = 4532
+	t_tsmultirange                              = 4533
+	t_tstzmultirange                            = 4534
+	t_datemultirange                            = 4535
+	t_int8multirange                            = 4536
 	t_pg_attrdef                                = 10000
 	t_pg_constraint                             = 10001
 	t_pg_inherits                               = 10002
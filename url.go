@@ -34,7 +34,7 @@ func ParseURL(url string) (string, error) {
 	var kvs []string
 	accrue := func(k, v string) {
 		if v != "" {
-			kvs = append(kvs, k+"="+v)
+			kvs = append(kvs, k+"="+quoteOpt(v))
 		}
 	}
 
@@ -66,3 +66,13 @@ func ParseURL(url string) (string, error) {
 	sort.Strings(kvs) // Makes testing easier (not a performance concern)
 	return strings.Join(kvs, " "), nil
 }
+
+// quoteOpt quotes a conninfo value for parseOpts if it holds spaces,
+// quotes or backslashes.
+func quoteOpt(v string) string {
+	if !strings.ContainsAny(v, conninfoSpace+`'\`) {
+		return v
+	}
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(v) + "'"
+}
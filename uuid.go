@@ -0,0 +1,176 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+)
+
+// UUID is a uuid value. Scan accepts the text and the 16 byte binary
+// forms.
+type UUID [16]byte
+
+// ParseUUID parses a UUID in the forms PostgreSQL accepts: with or
+// without hyphens, upper or lower case, and optionally in braces.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+
+	in := s
+	if len(in) >= 2 && in[0] == '{' && in[len(in)-1] == '}' {
+		in = in[1 : len(in)-1]
+	}
+
+	digits := make([]byte, 0, 32)
+	for i := 0; i < len(in); i++ {
+		// PostgreSQL allows a hyphen after any group of four digits.
+		if in[i] == '-' && len(digits) > 0 && len(digits)%4 == 0 && i+1 < len(in) && in[i+1] != '-' {
+			continue
+		}
+		digits = append(digits, in[i])
+	}
+
+	if len(digits) != 32 {
+		return u, fmt.Errorf("pq: invalid UUID %q", s)
+	}
+	if _, err := hex.Decode(u[:], digits); err != nil {
+		return u, fmt.Errorf("pq: invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+// String returns u in the canonical form, such as
+// a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11.
+func (u UUID) String() string {
+	return string(u.appendText(nil))
+}
+
+func (u UUID) appendText(b []byte) []byte {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return append(b, buf[:]...)
+}
+
+// Scan implements the Scanner interface.
+func (u *UUID) Scan(value interface{}) (err error) {
+	switch v := value.(type) {
+	case []byte:
+		if len(v) == 16 {
+			copy(u[:], v)
+			return nil
+		}
+		*u, err = ParseUUID(string(v))
+	case string:
+		*u, err = ParseUUID(v)
+	default:
+		err = fmt.Errorf("pq: cannot scan %T into UUID", value)
+	}
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (u UUID) MarshalText() ([]byte, error) {
+	return u.appendText(nil), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (u *UUID) UnmarshalText(text []byte) (err error) {
+	*u, err = ParseUUID(string(text))
+	return err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, producing the
+// binary wire format of uuid, which is simply its 16 bytes.
+func (u UUID) MarshalBinary() ([]byte, error) {
+	return u[:], nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (u *UUID) UnmarshalBinary(data []byte) error {
+	if len(data) != 16 {
+		return fmt.Errorf("pq: invalid binary UUID of length %d", len(data))
+	}
+	copy(u[:], data)
+	return nil
+}
+
+// NullUUID is a UUID that may be NULL.
+type NullUUID struct {
+	UUID  UUID
+	Valid bool // Valid is true if UUID is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (nu *NullUUID) Scan(value interface{}) error {
+	if value == nil {
+		nu.UUID, nu.Valid = UUID{}, false
+		return nil
+	}
+	nu.Valid = true
+	return nu.UUID.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (nu NullUUID) Value() (driver.Value, error) {
+	if !nu.Valid {
+		return nil, nil
+	}
+	return nu.UUID.Value()
+}
+
+// UUIDArray is a uuid[] value; NULL elements are not supported.
+type UUIDArray []UUID
+
+// Scan implements the Scanner interface.
+func (a *UUIDArray) Scan(value interface{}) error {
+	src, ok := value.([]byte)
+	if !ok {
+		if value == nil {
+			*a = nil
+			return nil
+		}
+		return fmt.Errorf("pq: cannot scan %T into UUIDArray", value)
+	}
+
+	elems, err := parseArray(src, ',')
+	if err != nil {
+		return err
+	}
+
+	b := make(UUIDArray, len(elems))
+	for i, e := range elems {
+		if e == nil {
+			return fmt.Errorf("pq: NULL element in uuid[] scanned into UUIDArray")
+		}
+		if b[i], err = ParseUUID(string(e)); err != nil {
+			return err
+		}
+	}
+	*a = b
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+func (a UUIDArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	elems := make([][]byte, len(a))
+	for i, u := range a {
+		elems[i] = u.appendText(nil)
+	}
+	return string(appendArray(nil, elems, ',')), nil
+}
@@ -0,0 +1,146 @@
+package pq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUUID(t *testing.T) {
+	want := "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+	for _, s := range []string{
+		"A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11",
+		"{a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11}",
+		"a0eebc999c0b4ef8bb6d6bb9bd380a11",
+		"a0ee-bc99-9c0b-4ef8-bb6d-6bb9-bd38-0a11",
+		"{a0eebc99-9c0b4ef8-bb6d6bb9-bd380a11}",
+	} {
+		u, err := ParseUUID(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if u.String() != want {
+			t.Errorf("%q: expected %s, got %s", s, want, u)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1",
+		"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a111",
+		"a0eebc99--9c0b-4ef8-bb6d-6bb9bd380a11",
+		"-a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11",
+		"g0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11",
+	} {
+		if _, err := ParseUUID(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestUUIDScan(t *testing.T) {
+	want, _ := ParseUUID("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")
+
+	for _, v := range []interface{}{want.String(), []byte(want.String()), want[:]} {
+		var u UUID
+		if err := u.Scan(v); err != nil {
+			t.Fatalf("%#v: %v", v, err)
+		}
+		if u != want {
+			t.Errorf("%#v: expected %s, got %s", v, want, u)
+		}
+	}
+
+	var nu NullUUID
+	if err := nu.Scan(nil); err != nil || nu.Valid {
+		t.Errorf("expected NULL, got %v, %v", nu, err)
+	}
+}
+
+func TestUUIDArray(t *testing.T) {
+	a, _ := ParseUUID("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")
+	b, _ := ParseUUID("00000000-0000-0000-0000-000000000001")
+
+	var got UUIDArray
+	err := got.Scan([]byte("{a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11,00000000-0000-0000-0000-000000000001}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, UUIDArray{a, b}) {
+		t.Errorf("unexpected %v", got)
+	}
+
+	if err := got.Scan([]byte("{a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11,NULL}")); err == nil {
+		t.Error("expected error for NULL element")
+	}
+
+	v, _ := UUIDArray{a, b}.Value()
+	want := `{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11","00000000-0000-0000-0000-000000000001"}`
+	if v != want {
+		t.Errorf("expected %s, got %v", want, v)
+	}
+}
+
+func TestParseArray(t *testing.T) {
+	for s, want := range map[string][][]byte{
+		`{}`:                    {},
+		`{a,b}`:                 {[]byte("a"), []byte("b")},
+		`{"a,b",NULL,"NULL"}`:   {[]byte("a,b"), nil, []byte("NULL")},
+		`{"say \"hi\"","a\\b"}`: {[]byte(`say "hi"`), []byte(`a\b`)},
+		`[0:1]={x,y}`:           {[]byte("x"), []byte("y")},
+		`{""}`:                  {[]byte{}},
+	} {
+		got, err := parseArray([]byte(s), ',')
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %q, got %q", s, want, got)
+		}
+
+		if len(got) > 0 {
+			again, err := parseArray(appendArray(nil, got, ','), ',')
+			if err != nil || !reflect.DeepEqual(again, want) {
+				t.Errorf("%s: round trip gave %q, %v", s, again, err)
+			}
+		}
+	}
+
+	for _, s := range []string{``, `{`, `{a,b`, `{{1,2},{3,4}}`, `{"a}`, `{"a"b}`} {
+		if _, err := parseArray([]byte(s), ','); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestUUIDRoundTrip(t *testing.T) {
+	db := openTestConn(t)
+	defer db.Close()
+
+	in, _ := ParseUUID("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")
+
+	var out UUID
+	if err := db.QueryRow("SELECT $1::uuid", in).Scan(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("expected %s, got %s", in, out)
+	}
+
+	var s string
+	if err := db.QueryRow("SELECT $1::uuid::text", [16]byte(in)).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != in.String() {
+		t.Errorf("expected %s, got %s", in, s)
+	}
+
+	var a UUIDArray
+	if err := db.QueryRow("SELECT $1::uuid[]", UUIDArray{in, in}).Scan(&a); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, UUIDArray{in, in}) {
+		t.Errorf("unexpected %v", a)
+	}
+}